@@ -199,8 +199,10 @@ func (e *APUEnvelope) TickEnvelope() {
 // APU
 type APU struct {
 	console       *Console
-	channel       chan float32
-	sampleRate    float64
+	buffer        *AudioBuffer
+	samples       []float32 // samples of the current frame
+	recorder      func(sample float32)
+	sampleRate    float64 // CPU cycles per sample
 	frameCounter  *FrameCounter
 	square1       *SquareChannel
 	square2       *SquareChannel
@@ -213,7 +215,31 @@ type APU struct {
 	frameValue    byte
 	needToRun     bool
 	frameIRQ      bool
-	filterChain   APUFilterChain
+	filterChain   [2]APUFilterChain // left (or mono) and right
+	mixer         apuMixer
+	stereo        bool
+	stems         *apuStems
+	scope         *APUScope
+
+	// last values written to $4000-$4017, for the register logger
+	registers      [apuRegisterCount]byte
+	registerLogger APURegisterLogger
+
+	// song end detection of the NSF player
+	writeHash uint64  // hash of the register writes since the last reset
+	peak      float32 // peak level of the samples since the last reset
+	fadeGain  float32
+
+	// sample rate conversion
+	quality     AudioQuality
+	blip        [2]*blipBuffer
+	sampleClock float64 // position between two samples (0-1)
+	lastOutput  [2]float32
+
+	// dynamic rate control
+	baseSampleRate      float64
+	rateControlTarget   int
+	rateControlMaxDelta float64
 }
 
 func NewAPU(console *Console) *APU {
@@ -225,6 +251,11 @@ func NewAPU(console *Console) *APU {
 	apu.triangle = NewTriangleChannel(console)
 	apu.noise = NewNoiseChannel(console)
 	apu.dmc = NewDeltaModulationChannel(console)
+	apu.buffer = NewAudioBuffer(DefaultAudioBufferSize)
+	apu.fadeGain = 1
+	apu.resetWriteHash()
+	apu.SetQuality(AudioQualityMedium)
+	apu.mixer.reset()
 	return &apu
 }
 
@@ -300,10 +331,48 @@ func (apu *APU) FrameCounterTick(frameType FrameType) {
 	}
 }
 
+func (apu *APU) SetQuality(quality AudioQuality) {
+	apu.quality = quality
+	for i := range apu.blip {
+		apu.blip[i] = newQualityBlipBuffer(quality)
+		apu.lastOutput[i] = 0
+	}
+	if apu.stems != nil {
+		apu.stems.init(apu)
+	}
+}
+
+func (apu *APU) Quality() AudioQuality {
+	return apu.quality
+}
+
+// SetStereo enables the stereo output: the samples are then interleaved
+// (left, right) and the channels are panned (see SetChannelPan). The audio
+// buffer is cleared.
+func (apu *APU) SetStereo(stereo bool) {
+	if stereo == apu.stereo {
+		return
+	}
+	apu.stereo = stereo
+	apu.samples = apu.samples[:0]
+	apu.buffer.Clear()
+	apu.SetQuality(apu.quality)
+}
+
+func (apu *APU) Stereo() bool {
+	return apu.stereo
+}
+
+// Channels returns the number of audio channels of the samples (1 or 2).
+func (apu *APU) Channels() int {
+	if apu.stereo {
+		return 2
+	}
+	return 1
+}
+
 func (apu *APU) Step() {
-	cycle1 := apu.currentCycle
 	apu.currentCycle++
-	cycle2 := apu.currentCycle
 
 	// XXX: Need apu.NeedToRun?
 	// XXX: Magic Number
@@ -315,33 +384,159 @@ func (apu *APU) Step() {
 
 	apu.Run()
 
-	// refs: github.com/fogleman/nes/nes/apu.go
-	s1 := int(float64(cycle1) / apu.sampleRate)
-	s2 := int(float64(cycle2) / apu.sampleRate)
-	if s1 != s2 {
+	if apu.sampleRate == 0 {
+		return
+	}
+
+	if apu.blip[0] != nil {
+		if apu.stereo {
+			left, right := apu.stereoOutput()
+			apu.addDelta(0, left)
+			apu.addDelta(1, right)
+		} else {
+			apu.addDelta(0, apu.output())
+		}
+	}
+	if apu.stems != nil {
+		apu.stems.addDeltas(apu)
+	}
+
+	apu.sampleClock += 1 / apu.sampleRate
+	if apu.sampleClock >= 1 {
+		apu.sampleClock -= 1
 		apu.sendSample()
 	}
 }
 
+// addDelta adds the change of the output of a side (0: left or mono, 1:
+// right) to its blip buffer.
+func (apu *APU) addDelta(side int, output float32) {
+	if output != apu.lastOutput[side] {
+		apu.blip[side].addDelta(1-apu.sampleClock, float64(output-apu.lastOutput[side]))
+		apu.lastOutput[side] = output
+	}
+}
+
 func (apu *APU) sendSample() {
-	output := apu.filterChain.Step(apu.output())
-	select {
-	case apu.channel <- output:
+	var left, right float32
+	switch {
+	case apu.blip[0] != nil:
+		left = float32(apu.blip[0].readSample())
+		if apu.stereo {
+			right = float32(apu.blip[1].readSample())
+		}
+	case apu.stereo:
+		left, right = apu.stereoOutput()
 	default:
+		left = apu.output()
+	}
+
+	mix := apu.filterChain[0].Step(left)
+	apu.emitSample(mix)
+	if apu.stereo {
+		right = apu.filterChain[1].Step(right)
+		apu.emitSample(right)
+		mix = (mix + right) / 2
+	}
+	if apu.stems != nil {
+		apu.stems.sendSample(apu)
+	}
+	if apu.scope != nil {
+		p1, p2, t, n, d := apu.channelOutputs()
+		apu.scope.add([APUChannelCount]float32{
+			float32(p1) / 15, float32(p2) / 15, float32(t) / 15, float32(n) / 15, float32(d) / 127,
+		}, mix*apu.fadeGain)
 	}
 }
 
+func (apu *APU) emitSample(sample float32) {
+	if sample > apu.peak {
+		apu.peak = sample
+	} else if -sample > apu.peak {
+		apu.peak = -sample
+	}
+	sample *= apu.fadeGain
+
+	if apu.recorder != nil {
+		apu.recorder(sample)
+	}
+	apu.samples = append(apu.samples, sample)
+}
+
+// flushSamples writes the samples of the frame to the audio buffer (once per
+// frame instead of once per sample).
+func (apu *APU) flushSamples() {
+	if len(apu.samples) == 0 {
+		return
+	}
+	apu.buffer.Write(apu.samples)
+	apu.samples = apu.samples[:0]
+	apu.updateRateControl()
+}
+
+// updateRateControl adjusts the sample rate to the fill level of the audio
+// buffer: slightly more samples per second below the target, less above.
+// refs: "Dynamic Rate Control for Retro Game Emulators" (Hans-Kristian Arntzen)
+func (apu *APU) updateRateControl() {
+	if apu.rateControlMaxDelta == 0 || apu.baseSampleRate == 0 {
+		return
+	}
+
+	fill := float64(apu.buffer.Len()) / float64(apu.rateControlTarget)
+	delta := 1 - fill
+	if delta > 1 {
+		delta = 1
+	} else if delta < -1 {
+		delta = -1
+	}
+	apu.sampleRate = apu.baseSampleRate / (1 + delta*apu.rateControlMaxDelta)
+}
+
+// channelOutputs returns the current output of each channel.
+func (apu *APU) channelOutputs() (p1, p2, t, n, d byte) {
+	return apu.square1.currentOutput, apu.square2.currentOutput, apu.triangle.currentOutput,
+		apu.noise.currentOutput, apu.dmc.currentOutput
+}
+
 func (apu *APU) output() float32 {
-	p1 := apu.square1.currentOutput
-	p2 := apu.square2.currentOutput
-	t := apu.triangle.currentOutput
-	n := apu.noise.currentOutput
-	d := apu.dmc.currentOutput
+	p1, p2, t, n, d := apu.channelOutputs()
+	if !apu.mixer.neutral {
+		return apu.mixedOutput(p1, p2, t, n, d, &apu.mixer.gain)
+	}
 	pulseOut := squareTable[p1+p2]
 	tndOut := tndTable[3*t+2*n+d]
 	return (pulseOut + tndOut)
 }
 
+// stereoOutput returns the left and right outputs, each mixed with the
+// panned gains.
+func (apu *APU) stereoOutput() (float32, float32) {
+	p1, p2, t, n, d := apu.channelOutputs()
+	return apu.mixedOutput(p1, p2, t, n, d, &apu.mixer.side[0]),
+		apu.mixedOutput(p1, p2, t, n, d, &apu.mixer.side[1])
+}
+
+// mixedOutput is output with gains: the formulas of the lookup tables with
+// non-integer inputs, or their linear approximation.
+// refs: https://www.nesdev.org/wiki/APU_Mixer
+func (apu *APU) mixedOutput(p1, p2, t, n, d byte, gain *[APUChannelCount]float32) float32 {
+	if apu.mixer.mode == MixLinear {
+		return 0.00752*(float32(p1)*gain[ChannelSquare1]+float32(p2)*gain[ChannelSquare2]) +
+			0.00851*float32(t)*gain[ChannelTriangle] +
+			0.00494*float32(n)*gain[ChannelNoise] +
+			0.00335*float32(d)*gain[ChannelDMC]
+	}
+
+	var pulseOut, tndOut float32
+	if pulse := float32(p1)*gain[ChannelSquare1] + float32(p2)*gain[ChannelSquare2]; pulse > 0 {
+		pulseOut = 95.52 / (8128.0/pulse + 100)
+	}
+	if tnd := 3*float32(t)*gain[ChannelTriangle] + 2*float32(n)*gain[ChannelNoise] + float32(d)*gain[ChannelDMC]; tnd > 0 {
+		tndOut = 163.67 / (24329.0/tnd + 100)
+	}
+	return pulseOut + tndOut
+}
+
 type NoiseInfo struct {
 	Out    byte
 	Period uint16
@@ -360,19 +555,21 @@ type APUCurrentInfo struct {
 	DMC      *DMCInfo
 }
 
-func (apu *APU) CurrentInfo() *APUCurrentInfo {
-	var s1 float32 = 0
-	if apu.square1.realPeriod != 0 {
-		s1 = float32(CPUFrequency) / (16.0 * (float32(apu.square1.realPeriod) + 1))
-	}
-	var s2 float32 = 0
-	if apu.square2.realPeriod != 0 {
-		s2 = float32(CPUFrequency) / (16.0 * (float32(apu.square2.realPeriod) + 1))
-	}
-	var t float32 = 0
-	if apu.triangle.apuLengthCounter.baseAPUChannel.period != 0 {
-		t = float32(CPUFrequency) / (16.0 * (float32(apu.triangle.apuLengthCounter.baseAPUChannel.period) + 1))
+// periodFrequency returns the frequency (Hz) of a channel playing a
+// sequence of steps at a timer period (0 when the period is 0).
+func periodFrequency(period uint16, steps float32) float32 {
+	if period == 0 {
+		return 0
 	}
+	return float32(CPUFrequency) / (steps * (float32(period) + 1))
+}
+
+func (apu *APU) CurrentInfo() *APUCurrentInfo {
+	// (the duty sequence has 8 steps clocked every 2 CPU cycles, the
+	// triangle sequence 32 steps clocked every CPU cycle)
+	s1 := periodFrequency(apu.square1.realPeriod, 16)
+	s2 := periodFrequency(apu.square2.realPeriod, 16)
+	t := periodFrequency(apu.triangle.apuLengthCounter.baseAPUChannel.period, 32)
 
 	n := &NoiseInfo{}
 	n.Out = apu.noise.currentOutput
@@ -391,6 +588,47 @@ func (apu *APU) CurrentInfo() *APUCurrentInfo {
 	}
 }
 
+// APUChannelState is the musical state of a channel, e.g. for transcription.
+type APUChannelState struct {
+	Frequency float32 // Hz, as in CurrentInfo (0 for the noise and the DMC)
+	Volume    byte    // 0-15 (the triangle and the DMC have no volume: 15)
+	Duty      byte    // square: duty cycle 0-3 (12.5%, 25%, 50%, 75%)
+	Period    byte    // noise: period index 0-15 ($400E)
+	ShortMode bool    // noise: short (metallic) mode ($400E)
+	Playing   bool    // not silenced by its length, linear counter or sweep
+}
+
+func (apu *APU) ChannelState(channel APUChannel) APUChannelState {
+	var state APUChannelState
+	switch channel {
+	case ChannelSquare1, ChannelSquare2:
+		s := apu.square1
+		if channel == ChannelSquare2 {
+			s = apu.square2
+		}
+		state.Frequency = periodFrequency(s.realPeriod, 16)
+		state.Volume = byte(s.apuEnvelope.GetVolume())
+		state.Duty = s.duty
+		state.Playing = s.apuEnvelope.apuLengthCounter.GetStatus() && !s.IsMuted()
+	case ChannelTriangle:
+		t := apu.triangle
+		period := t.apuLengthCounter.baseAPUChannel.period
+		state.Frequency = periodFrequency(period, 32)
+		state.Volume = 15
+		// (periods < 2 are ultrasonic: the output is frozen)
+		state.Playing = t.apuLengthCounter.GetStatus() && t.linearCounter > 0 && period >= 2
+	case ChannelNoise:
+		state.Volume = byte(apu.noise.apuEnvelope.GetVolume())
+		state.Period = apu.registers[0x0E] & 0x0F
+		state.ShortMode = apu.registers[0x0E]&0x80 != 0
+		state.Playing = apu.noise.apuEnvelope.apuLengthCounter.GetStatus()
+	case ChannelDMC:
+		state.Volume = 15
+		state.Playing = apu.dmc.GetStatus()
+	}
+	return state
+}
+
 func (apu *APU) readRegister(address uint16) byte {
 	var status byte
 	switch address {
@@ -451,6 +689,7 @@ func (apu *APU) writeRegister(address uint16, value byte) {
 		// default:
 		// 	log.Fatalf("unhandled apu register write at address: 0x%04X", address)
 	}
+	apu.logRegister(address, value)
 }
 
 func (apu *APU) readStatus() byte {
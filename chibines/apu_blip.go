@@ -0,0 +1,127 @@
+// refs: http://www.slack.net/~ant/bl-synth/ (band-limited sound synthesis)
+package chibines
+
+import (
+	"fmt"
+	"math"
+)
+
+// AudioQuality selects how the APU output (1.79 MHz) is converted to the
+// audio sample rate.
+type AudioQuality int
+
+const (
+	// AudioQualityLow picks the output at each sample (fast, but high
+	// pitched pulse and noise alias).
+	AudioQualityLow AudioQuality = iota
+	// AudioQualityMedium synthesizes band-limited steps with 8 taps.
+	AudioQualityMedium
+	// AudioQualityHigh synthesizes band-limited steps with 32 taps.
+	AudioQualityHigh
+)
+
+var audioQualityNames = []string{"low", "medium", "high"}
+
+func (q AudioQuality) String() string {
+	if int(q) < len(audioQualityNames) {
+		return audioQualityNames[q]
+	}
+	return fmt.Sprintf("AudioQuality(%d)", int(q))
+}
+
+func ParseAudioQuality(s string) (AudioQuality, error) {
+	for i, name := range audioQualityNames {
+		if name == s {
+			return AudioQuality(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown audio quality: %s", s)
+}
+
+const (
+	blipPhases = 64
+	blipCutoff = 0.45 // of the sample rate
+)
+
+// blipBuffer converts amplitude changes at any time into samples without
+// aliasing. Each change adds a band-limited impulse (windowed sinc) to the
+// following samples, and the samples are the running sum of the impulses,
+// i.e. band-limited steps. The output is delayed by halfWidth samples.
+type blipBuffer struct {
+	halfWidth int
+	kernel    [blipPhases + 1][]float64
+	buf       []float64
+	head      int
+	mask      int
+	sum       float64
+}
+
+// newQualityBlipBuffer returns the blip buffer of a quality (nil for
+// AudioQualityLow).
+func newQualityBlipBuffer(quality AudioQuality) *blipBuffer {
+	switch quality {
+	case AudioQualityMedium:
+		return newBlipBuffer(4)
+	case AudioQualityHigh:
+		return newBlipBuffer(16)
+	}
+	return nil
+}
+
+func newBlipBuffer(halfWidth int) *blipBuffer {
+	b := &blipBuffer{halfWidth: halfWidth}
+
+	size := 1
+	for size < halfWidth*4 {
+		size <<= 1
+	}
+	b.buf = make([]float64, size)
+	b.mask = size - 1
+
+	for phase := range b.kernel {
+		taps := make([]float64, halfWidth*2)
+		total := 0.0
+		for i := range taps {
+			// distance of the tap from the step, in samples
+			x := float64(i-halfWidth) + float64(phase)/blipPhases
+			taps[i] = blipImpulse(x, float64(halfWidth))
+			total += taps[i]
+		}
+		// each step must add exactly its amplitude
+		for i := range taps {
+			taps[i] /= total
+		}
+		b.kernel[phase] = taps
+	}
+	return b
+}
+
+// blipImpulse is a low-pass (windowed sinc, Blackman window) impulse.
+func blipImpulse(x, halfWidth float64) float64 {
+	if math.Abs(x) >= halfWidth {
+		return 0
+	}
+	sinc := 1.0
+	if x != 0 {
+		sinc = math.Sin(2*math.Pi*blipCutoff*x) / (2 * math.Pi * blipCutoff * x)
+	}
+	window := 0.42 + 0.5*math.Cos(math.Pi*x/halfWidth) + 0.08*math.Cos(2*math.Pi*x/halfWidth)
+	return sinc * window
+}
+
+// addDelta adds an amplitude change happening offset (0-1) samples before
+// the next sample.
+func (b *blipBuffer) addDelta(offset float64, delta float64) {
+	taps := b.kernel[int(offset*blipPhases+0.5)]
+	for i, tap := range taps {
+		b.buf[(b.head+i)&b.mask] += delta * tap
+	}
+}
+
+// readSample returns the next sample.
+func (b *blipBuffer) readSample() float64 {
+	b.sum += b.buf[b.head]
+	b.buf[b.head] = 0
+	b.head = (b.head + 1) & b.mask
+	return b.sum
+}
@@ -0,0 +1,98 @@
+// ORIGINAL
+package chibines
+
+// APURegisterLogger receives the writes to the APU registers ($4000-$4017),
+// e.g. to log the music as VGM (see package vgm). The cycles are CPU cycle
+// counts: only their differences are meaningful.
+//
+// Expansion audio (FDS, VRC6, ...) is not emulated, so only the 2A03
+// registers are logged.
+type APURegisterLogger interface {
+	// WriteRegister is called after each write to a register.
+	WriteRegister(cycle uint64, address uint16, value byte)
+	// WriteSampleData is called with the memory ($8000-$FFFF) of the DPCM
+	// sample when the DMC may start playing it: on writes to $4012, $4013,
+	// and to $4015 with the DMC bit set.
+	WriteSampleData(cycle uint64, address uint16, data []byte)
+	// EndLog is called when the logger is removed.
+	EndLog(cycle uint64)
+}
+
+const apuRegisterCount = 0x18 // $4000-$4017
+
+// SetRegisterLogger sets the logger of the register writes (nil removes
+// it). The logger first receives the last value written to each register,
+// so the log starts from the current state.
+func (apu *APU) SetRegisterLogger(logger APURegisterLogger) {
+	cycle := apu.console.CPU.cycleCount
+	if apu.registerLogger != nil {
+		apu.registerLogger.EndLog(cycle)
+	}
+	apu.registerLogger = logger
+	if logger == nil {
+		return
+	}
+
+	for i, value := range apu.registers {
+		address := 0x4000 + uint16(i)
+		switch address {
+		case 0x4009, 0x400D, 0x4014, 0x4016:
+			// not APU registers
+		case 0x4015, 0x4017:
+			// after the channel registers (below)
+		default:
+			logger.WriteRegister(cycle, address, value)
+		}
+	}
+	apu.logSampleData(cycle)
+	logger.WriteRegister(cycle, 0x4015, apu.registers[0x15])
+	logger.WriteRegister(cycle, 0x4017, apu.registers[0x17])
+}
+
+func (apu *APU) logRegister(address uint16, value byte) {
+	apu.registers[address-0x4000] = value
+	apu.writeHash = (apu.writeHash ^ uint64(address)<<8 ^ uint64(value)) * fnvPrime64
+	if apu.registerLogger == nil {
+		return
+	}
+
+	cycle := apu.console.CPU.cycleCount
+	switch {
+	case address == 0x4012, address == 0x4013, address == 0x4015 && value&0x10 != 0:
+		apu.logSampleData(cycle)
+	}
+	apu.registerLogger.WriteRegister(cycle, address, value)
+}
+
+// logSampleData sends the memory of the DPCM sample set by $4012 / $4013
+// (in two parts when it wraps around from $FFFF to $8000).
+func (apu *APU) logSampleData(cycle uint64) {
+	address := 0xC000 | uint16(apu.registers[0x12])<<6
+	length := int(apu.registers[0x13])<<4 | 1
+
+	mapper := apu.console.CPU.bus.Cartridge.Mapper
+	for length > 0 {
+		n := 0x10000 - int(address)
+		if n > length {
+			n = length
+		}
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = mapper.ReadMemory(address + uint16(i))
+		}
+		apu.registerLogger.WriteSampleData(cycle, address, data)
+
+		length -= n
+		address = 0x8000
+	}
+}
+
+// FNV-1a constants (the hash takes a step per register write)
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+func (apu *APU) resetWriteHash() {
+	apu.writeHash = fnvOffset64
+}
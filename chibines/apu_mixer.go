@@ -0,0 +1,227 @@
+// ORIGINAL
+package chibines
+
+import "fmt"
+
+// APUChannel identifies a sound channel for the mixer.
+type APUChannel int
+
+const (
+	ChannelSquare1 APUChannel = iota
+	ChannelSquare2
+	ChannelTriangle
+	ChannelNoise
+	ChannelDMC
+
+	// APUChannelCount is the number of channels (expansion audio channels
+	// would be added before it).
+	APUChannelCount
+)
+
+var apuChannelNames = [APUChannelCount]string{"Square 1", "Square 2", "Triangle", "Noise", "DMC"}
+
+func (c APUChannel) String() string {
+	if c >= 0 && c < APUChannelCount {
+		return apuChannelNames[c]
+	}
+	return fmt.Sprintf("APUChannel(%d)", int(c))
+}
+
+// APUMixMode selects how the channels are mixed together.
+type APUMixMode int
+
+const (
+	// MixNonlinear mixes like the NES DAC: loud channels attenuate the others
+	// (the default).
+	MixNonlinear APUMixMode = iota
+	// MixLinear sums the channels with the linear approximation of the DAC,
+	// so each channel sounds the same alone as in the mix (e.g. for stems).
+	MixLinear
+)
+
+var apuMixModeNames = []string{"nonlinear", "linear"}
+
+func (m APUMixMode) String() string {
+	if int(m) < len(apuMixModeNames) {
+		return apuMixModeNames[m]
+	}
+	return fmt.Sprintf("APUMixMode(%d)", int(m))
+}
+
+func ParseAPUMixMode(s string) (APUMixMode, error) {
+	for i, name := range apuMixModeNames {
+		if name == s {
+			return APUMixMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mix mode: %s", s)
+}
+
+// Panning presets: the pan of each channel, from -1 (left) to 1 (right).
+var panningPresets = []struct {
+	name string
+	pan  [APUChannelCount]float32
+}{
+	{"mono", [APUChannelCount]float32{0, 0, 0, 0, 0}},
+	{"pulses", [APUChannelCount]float32{-0.5, 0.5, 0, 0, 0}},
+	{"wide", [APUChannelCount]float32{-0.8, 0.8, 0, 0.3, -0.3}},
+}
+
+// PanningPresets returns the names of the panning presets.
+func PanningPresets() []string {
+	names := make([]string, len(panningPresets))
+	for i, preset := range panningPresets {
+		names[i] = preset.name
+	}
+	return names
+}
+
+// apuMixer holds the mute / solo / volume / pan settings of each channel.
+// The gains are applied to the channel outputs before the mixing.
+type apuMixer struct {
+	volume [APUChannelCount]float32
+	mute   [APUChannelCount]bool
+	solo   [APUChannelCount]bool
+	pan    [APUChannelCount]float32
+	mode   APUMixMode
+
+	gain    [APUChannelCount]float32
+	side    [2][APUChannelCount]float32 // gains of the left and right outputs
+	neutral bool                        // all gains are 1 and nonlinear: the lookup tables can be used
+}
+
+func (m *apuMixer) reset() {
+	for i := range m.volume {
+		m.volume[i] = 1
+		m.mute[i] = false
+		m.solo[i] = false
+	}
+	m.update()
+}
+
+func (m *apuMixer) update() {
+	soloed := false
+	for _, solo := range m.solo {
+		soloed = soloed || solo
+	}
+
+	m.neutral = m.mode == MixNonlinear
+	for i := range m.gain {
+		m.gain[i] = m.volume[i]
+		if m.mute[i] || (soloed && !m.solo[i]) {
+			m.gain[i] = 0
+		}
+		if m.gain[i] != 1 {
+			m.neutral = false
+		}
+
+		// balance: the center is at full volume on both sides
+		m.side[0][i] = m.gain[i] * minFloat32(1, 1-m.pan[i])
+		m.side[1][i] = m.gain[i] * minFloat32(1, 1+m.pan[i])
+	}
+}
+
+func minFloat32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func validChannel(channel APUChannel) bool {
+	return channel >= 0 && channel < APUChannelCount
+}
+
+// SetChannelVolume sets the volume of a channel (1.0 = normal).
+func (apu *APU) SetChannelVolume(channel APUChannel, volume float32) {
+	if !validChannel(channel) {
+		return
+	}
+	if volume < 0 {
+		volume = 0
+	}
+	apu.mixer.volume[channel] = volume
+	apu.mixer.update()
+}
+
+func (apu *APU) ChannelVolume(channel APUChannel) float32 {
+	if !validChannel(channel) {
+		return 0
+	}
+	return apu.mixer.volume[channel]
+}
+
+func (apu *APU) SetChannelMute(channel APUChannel, mute bool) {
+	if !validChannel(channel) {
+		return
+	}
+	apu.mixer.mute[channel] = mute
+	apu.mixer.update()
+}
+
+func (apu *APU) ChannelMute(channel APUChannel) bool {
+	return validChannel(channel) && apu.mixer.mute[channel]
+}
+
+// SetChannelSolo sets the solo of a channel: when any channel is soloed,
+// only the soloed channels are heard.
+func (apu *APU) SetChannelSolo(channel APUChannel, solo bool) {
+	if !validChannel(channel) {
+		return
+	}
+	apu.mixer.solo[channel] = solo
+	apu.mixer.update()
+}
+
+func (apu *APU) ChannelSolo(channel APUChannel) bool {
+	return validChannel(channel) && apu.mixer.solo[channel]
+}
+
+// SetChannelPan sets the position of a channel in the stereo output, from -1
+// (left) to 1 (right). It is only heard when stereo is enabled.
+func (apu *APU) SetChannelPan(channel APUChannel, pan float32) {
+	if !validChannel(channel) {
+		return
+	}
+	if pan < -1 {
+		pan = -1
+	} else if pan > 1 {
+		pan = 1
+	}
+	apu.mixer.pan[channel] = pan
+	apu.mixer.update()
+}
+
+func (apu *APU) ChannelPan(channel APUChannel) float32 {
+	if !validChannel(channel) {
+		return 0
+	}
+	return apu.mixer.pan[channel]
+}
+
+// SetPanningPreset sets the pan of all the channels (see PanningPresets).
+func (apu *APU) SetPanningPreset(name string) error {
+	for _, preset := range panningPresets {
+		if preset.name == name {
+			apu.mixer.pan = preset.pan
+			apu.mixer.update()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown panning preset: %s", name)
+}
+
+func (apu *APU) SetMixMode(mode APUMixMode) {
+	apu.mixer.mode = mode
+	apu.mixer.update()
+}
+
+func (apu *APU) MixMode() APUMixMode {
+	return apu.mixer.mode
+}
+
+// ResetMixer unmutes and unsolos all channels and sets their volume to 1.
+// The pans and the mix mode are kept.
+func (apu *APU) ResetMixer() {
+	apu.mixer.reset()
+}
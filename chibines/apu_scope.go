@@ -0,0 +1,138 @@
+// ORIGINAL
+package chibines
+
+import "sync"
+
+// APUScope keeps the last samples of each channel and of the mix, at the
+// audio sample rate, for oscilloscope and spectrum views. The channel
+// samples are the outputs of the channels before the mixer (0-1), the mix
+// samples are the audio output (left and right averaged). It can be read
+// while the console runs on another goroutine.
+type APUScope struct {
+	mu       sync.Mutex
+	channels [APUChannelCount][]float32
+	mix      []float32
+	pos      int // next write position in the ring buffers
+	tmp      []float32
+}
+
+func newAPUScope(size int) *APUScope {
+	s := &APUScope{
+		mix: make([]float32, size),
+		tmp: make([]float32, size),
+	}
+	for i := range s.channels {
+		s.channels[i] = make([]float32, size)
+	}
+	return s
+}
+
+// SetScopeSize starts capturing the last size samples of each channel (see
+// APUScope). 0 stops capturing.
+func (apu *APU) SetScopeSize(size int) {
+	if size <= 0 {
+		apu.scope = nil
+		return
+	}
+	apu.scope = newAPUScope(size)
+}
+
+// Scope returns the capture buffer (nil when not capturing).
+func (apu *APU) Scope() *APUScope {
+	return apu.scope
+}
+
+func (s *APUScope) add(outputs [APUChannelCount]float32, mix float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, output := range outputs {
+		s.channels[i][s.pos] = output
+	}
+	s.mix[s.pos] = mix
+	s.pos = (s.pos + 1) % len(s.mix)
+}
+
+func (s *APUScope) Size() int {
+	return len(s.mix)
+}
+
+// readLast copies the last len(out) samples of buf to out, oldest first.
+func (s *APUScope) readLast(buf []float32, out []float32) {
+	start := (s.pos - len(out) + len(buf)) % len(buf)
+	copied := copy(out, buf[start:])
+	copy(out[copied:], buf)
+}
+
+// ReadChannel copies the last len(out) samples (at most Size) of a channel
+// to out, oldest first.
+func (s *APUScope) ReadChannel(channel APUChannel, out []float32) {
+	if !validChannel(channel) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readLast(s.channels[channel], out[:minInt(len(out), len(s.mix))])
+}
+
+// ReadMix copies the last len(out) samples (at most Size) of the mix to out,
+// oldest first.
+func (s *APUScope) ReadMix(out []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readLast(s.mix, out[:minInt(len(out), len(s.mix))])
+}
+
+// ReadWaveform copies len(out) samples (at most Size / 2) of a channel which
+// start at a rising edge, so that a periodic waveform stays still from a
+// call to the next (like the trigger of an oscilloscope). The latest edge
+// of the last 2 * len(out) samples is taken; without edge, the last samples
+// are copied.
+func (s *APUScope) ReadWaveform(channel APUChannel, out []float32) {
+	if !validChannel(channel) {
+		return
+	}
+	n := minInt(len(out), len(s.mix)/2)
+	if n == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf := s.tmp[:n*2]
+	s.readLast(s.channels[channel], buf)
+	start := findTrigger(buf, n)
+	copy(out, buf[start:start+n])
+}
+
+// findTrigger returns the start of the window of n samples of buf which
+// starts at the latest rising edge through the middle level.
+func findTrigger(buf []float32, n int) int {
+	low, high := buf[0], buf[0]
+	for _, v := range buf {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	last := len(buf) - n
+	if low == high {
+		return last
+	}
+
+	level := (low + high) / 2
+	for i := last; i > 0; i-- {
+		if buf[i-1] < level && buf[i] >= level {
+			return i
+		}
+	}
+	return last
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+// ORIGINAL
+package chibines
+
+// apuStems renders each channel alone (its stem) along with the mix, with
+// the same sample clock, synthesis and filters, so the stems are sample
+// aligned with the mix. A stem is the channel mixed alone (soloed) with its
+// volume; with MixLinear the stems add up to the mix.
+type apuStems struct {
+	recorder    func(samples []float32)
+	blip        [APUChannelCount]*blipBuffer
+	lastOutput  [APUChannelCount]float32
+	filterChain [APUChannelCount]APUFilterChain
+	samples     []float32
+}
+
+// SetStemRecorder enables the stems (see Console.SetStemRecorder). nil
+// disables them.
+func (apu *APU) SetStemRecorder(recorder func(samples []float32)) {
+	if recorder == nil {
+		apu.stems = nil
+		return
+	}
+	apu.stems = &apuStems{
+		recorder: recorder,
+		samples:  make([]float32, APUChannelCount),
+	}
+	apu.stems.init(apu)
+}
+
+// init (re)creates the blip buffers and filters for the quality and sample
+// rate of the APU.
+func (s *apuStems) init(apu *APU) {
+	sampleRate := 0.0
+	if apu.baseSampleRate != 0 {
+		sampleRate = CPUFrequency / apu.baseSampleRate
+	}
+	for i := range s.blip {
+		s.blip[i] = newQualityBlipBuffer(apu.quality)
+		s.lastOutput[i] = 0
+		s.filterChain[i] = newAPUFilterChain(sampleRate)
+	}
+}
+
+// outputs returns the output of each channel alone.
+func (s *apuStems) outputs(apu *APU) [APUChannelCount]float32 {
+	p1, p2, t, n, d := apu.channelOutputs()
+	var outputs [APUChannelCount]float32
+	for i := range outputs {
+		var gain [APUChannelCount]float32
+		gain[i] = apu.mixer.volume[i]
+		outputs[i] = apu.mixedOutput(p1, p2, t, n, d, &gain)
+	}
+	return outputs
+}
+
+func (s *apuStems) addDeltas(apu *APU) {
+	if s.blip[0] == nil {
+		return
+	}
+	for i, output := range s.outputs(apu) {
+		if output != s.lastOutput[i] {
+			s.blip[i].addDelta(1-apu.sampleClock, float64(output-s.lastOutput[i]))
+			s.lastOutput[i] = output
+		}
+	}
+}
+
+func (s *apuStems) sendSample(apu *APU) {
+	if s.blip[0] != nil {
+		for i, blip := range s.blip {
+			s.samples[i] = float32(blip.readSample())
+		}
+	} else {
+		outputs := s.outputs(apu)
+		copy(s.samples, outputs[:])
+	}
+	for i := range s.samples {
+		// faded out like the mix (see NSFPlayer)
+		s.samples[i] = s.filterChain[i].Step(s.samples[i]) * apu.fadeGain
+	}
+	s.recorder(s.samples)
+}
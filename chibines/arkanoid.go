@@ -0,0 +1,90 @@
+// refs: github.com/libretro/Mesen
+package chibines
+
+// Arkanoid "Vaus" controller
+// https://www.nesdev.org/wiki/Arkanoid_controller
+const (
+	// potentiometer range of the NES/Famicom controllers
+	arkanoidMinPosition = 0x62
+	arkanoidMaxPosition = 0xF2
+	// bits shifted out per strobe
+	arkanoidReportBits = 9
+)
+
+// ArkanoidController is the Arkanoid paddle.
+// NES (controller port):
+// D3: button, D4: potentiometer (serial, MSB first, inverted)
+// Famicom (expansion port):
+// $4016 D1: button, $4017 D1: potentiometer (serial, MSB first, inverted)
+type ArkanoidController struct {
+	famicom bool
+
+	position byte
+	button   bool
+	strobe   byte
+	report   uint16
+}
+
+func NewArkanoidController(famicom bool) *ArkanoidController {
+	return &ArkanoidController{
+		famicom:  famicom,
+		position: arkanoidMinPosition,
+	}
+}
+
+// SetState sets the knob position (x: 0-255, left to right) and the button.
+func (a *ArkanoidController) SetState(x int, button bool) {
+	if x < 0 {
+		x = 0
+	} else if x > 255 {
+		x = 255
+	}
+	a.position = byte(arkanoidMinPosition + x*(arkanoidMaxPosition-arkanoidMinPosition)/255)
+	a.button = button
+}
+
+func (a *ArkanoidController) reload() {
+	// 8-bit position followed by the ninth (lowest) bit
+	a.report = uint16(a.position) << 1
+}
+
+// serialBit returns the next potentiometer bit (inverted).
+func (a *ArkanoidController) serialBit() byte {
+	if a.strobe&1 == 1 {
+		a.reload()
+	}
+	value := byte(^a.report>>(arkanoidReportBits-1)) & 0x01
+	a.report <<= 1
+	return value
+}
+
+func (a *ArkanoidController) Read(address uint16) byte {
+	var value byte
+	if a.famicom {
+		switch address {
+		case 0x4016:
+			if a.button {
+				value |= 0x02
+			}
+		case 0x4017:
+			value |= a.serialBit() << 1
+		}
+	} else {
+		value |= a.serialBit() << 4
+		if a.button {
+			value |= 0x08
+		}
+	}
+	return value
+}
+
+func (a *ArkanoidController) Write(value byte) {
+	prev := a.strobe
+	a.strobe = value
+	if prev&1 == 1 && a.strobe&1 == 0 {
+		a.reload()
+	}
+}
+
+func (a *ArkanoidController) UpdateFrame() {
+}
@@ -0,0 +1,169 @@
+// ORIGINAL
+package chibines
+
+import "sync"
+
+// DefaultAudioBufferSize is the capacity (in samples) of the audio buffer of
+// a console: about 0.35 seconds at 48kHz.
+const DefaultAudioBufferSize = 16384
+
+// AudioBuffer is a ring buffer of samples (mono, or interleaved stereo)
+// between the APU, which writes the samples of each frame at once, and the
+// audio output, which pulls them with ReadSamples (e.g. from an audio
+// callback). Its capacity must be even so stereo pairs are never split.
+//
+// In blocking mode (for offline rendering) Write waits for free space and
+// ReadSamples waits until it can fill its whole buffer, so no sample is lost.
+// Otherwise both return immediately and count overruns / underruns.
+type AudioBuffer struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	samples  []float32
+	start    int
+	count    int
+	blocking bool
+
+	// after an underrun, nothing is read until prefill samples are buffered
+	prefill  int
+	starving bool
+
+	underruns uint64
+	overruns  uint64
+}
+
+func NewAudioBuffer(size int) *AudioBuffer {
+	b := &AudioBuffer{
+		samples: make([]float32, size),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Write appends samples. When the buffer is full, the samples that don't fit
+// are dropped (overrun), or waited for in blocking mode.
+func (b *AudioBuffer) Write(samples []float32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(samples) > 0 {
+		free := len(b.samples) - b.count
+		if free == 0 {
+			if !b.blocking {
+				b.overruns++
+				return
+			}
+			b.cond.Wait()
+			continue
+		}
+
+		n := len(samples)
+		if n > free {
+			n = free
+		}
+		end := (b.start + b.count) % len(b.samples)
+		copied := copy(b.samples[end:], samples[:n])
+		copy(b.samples, samples[copied:n])
+		b.count += n
+		samples = samples[n:]
+		b.cond.Broadcast()
+	}
+}
+
+// ReadSamples moves up to len(out) samples to out and returns their number.
+// Returning less than len(out) is an underrun. In blocking mode it waits
+// for len(out) samples, or a full buffer.
+func (b *AudioBuffer) ReadSamples(out []float32) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// (at most a full buffer: the writer waits for free space)
+	for b.blocking && b.count < len(out) && b.count < len(b.samples) {
+		b.cond.Wait()
+	}
+
+	if b.starving && !b.blocking {
+		if b.count < b.prefill {
+			b.underruns++
+			return 0
+		}
+		b.starving = false
+	}
+
+	n := len(out)
+	if n > b.count {
+		n = b.count
+		b.underruns++
+		b.starving = true
+	}
+	copied := copy(out[:n], b.samples[b.start:])
+	copy(out[copied:n], b.samples)
+	b.start = (b.start + n) % len(b.samples)
+	b.count -= n
+	b.cond.Broadcast()
+	return n
+}
+
+// Len returns the number of samples waiting to be read.
+func (b *AudioBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+func (b *AudioBuffer) Cap() int {
+	return len(b.samples)
+}
+
+// Clear drops the samples waiting to be read.
+func (b *AudioBuffer) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start = 0
+	b.count = 0
+	b.cond.Broadcast()
+}
+
+// SetPrefill makes ReadSamples wait (return nothing) after an underrun until
+// n samples are buffered, instead of underrunning again on every read.
+func (b *AudioBuffer) SetPrefill(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prefill = n
+}
+
+// SetBlocking sets the blocking mode. Disabling it wakes up the waiting
+// Write and ReadSamples.
+func (b *AudioBuffer) SetBlocking(blocking bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocking = blocking
+	b.cond.Broadcast()
+}
+
+func (b *AudioBuffer) Blocking() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.blocking
+}
+
+// Underruns returns the number of ReadSamples calls which could not fill
+// their buffer.
+func (b *AudioBuffer) Underruns() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.underruns
+}
+
+// Overruns returns the number of Write calls which dropped samples.
+func (b *AudioBuffer) Overruns() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.overruns
+}
+
+func (b *AudioBuffer) ResetCounters() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.underruns = 0
+	b.overruns = 0
+}
@@ -5,24 +5,25 @@ import (
 )
 
 type Bus struct {
-	CPU         *CPU
-	PPU         *PPU
-	APU         *APU
-	Controller1 *Controller
-	Controller2 *Controller
-	Cartridge   *Cartridge
-	WRAM        [2048]byte // 2 KiB
-	openBus     byte
+	CPU           *CPU
+	PPU           *PPU
+	APU           *APU
+	Port1         InputDevice
+	Port2         InputDevice
+	ExpansionPort InputDevice
+	Cartridge     *Cartridge
+	WRAM          [2048]byte // 2 KiB
+	openBus       byte
 }
 
-func NewBus(cpu *CPU, ppu *PPU, apu *APU, controller1 *Controller, controller2 *Controller, cartridge *Cartridge) *Bus {
+func NewBus(cpu *CPU, ppu *PPU, apu *APU, port1 InputDevice, port2 InputDevice, cartridge *Cartridge) *Bus {
 	return &Bus{
-		CPU:         cpu,
-		PPU:         ppu,
-		APU:         apu,
-		Controller1: controller1,
-		Controller2: controller2,
-		Cartridge:   cartridge,
+		CPU:       cpu,
+		PPU:       ppu,
+		APU:       apu,
+		Port1:     port1,
+		Port2:     port2,
+		Cartridge: cartridge,
 	}
 }
 
@@ -52,9 +53,9 @@ func (b *Bus) ReadMemory(address uint16) byte {
 	case address == 0x4015:
 		value = b.APU.readRegister(address)
 	case address == 0x4016:
-		value = b.Controller1.Read()
+		value = b.readInputPort(address)
 	case address == 0x4017:
-		value = b.Controller2.Read()
+		value = b.readInputPort(address)
 	case address >= 0x4018 && address < 0x4100:
 		// $4018-$40FF
 		value = b.Cartridge.Mapper.ExRead(address)
@@ -112,8 +113,7 @@ func (b *Bus) WriteMemory(address uint16, value byte) {
 		b.APU.writeRegister(address, value)
 	case address == 0x4016:
 		// $4016
-		b.Controller1.Write(value)
-		b.Controller2.Write(value)
+		b.writeInputPort(value)
 	case address == 0x4017:
 		// $4017
 		b.APU.writeRegister(address, value)
@@ -0,0 +1,180 @@
+// ORIGINAL
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+)
+
+// Animated PNG. Each frame is encoded by image/png and its IDAT data is
+// written as IDAT (first frame) or fdAT chunks.
+// https://wiki.mozilla.org/APNG_Specification
+const (
+	apngSignature = "\x89PNG\r\n\x1a\n"
+
+	// offset of the acTL data: signature, IHDR (13 bytes), acTL header
+	apngACTLData = 8 + 8 + 13 + 4 + 8
+)
+
+type apngEncoder struct {
+	file    *os.File
+	w       *bufio.Writer
+	encoder png.Encoder
+	clock   frameClock
+	buf     bytes.Buffer
+	ihdr    []byte
+	seq     uint32
+	frames  uint32
+}
+
+func newAPNGEncoder(path string) (*apngEncoder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &apngEncoder{
+		file:    file,
+		w:       bufio.NewWriter(file),
+		encoder: png.Encoder{CompressionLevel: png.BestSpeed},
+		clock:   frameClock{unit: 1000},
+	}, nil
+}
+
+func (e *apngEncoder) writeChunk(chunkType string, data ...[]byte) error {
+	size := 0
+	for _, d := range data {
+		size += len(d)
+	}
+
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:], uint32(size))
+	copy(header[4:], chunkType)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	for _, d := range data {
+		crc.Write(d)
+		if _, err := e.w.Write(d); err != nil {
+			return err
+		}
+	}
+	return binary.Write(e.w, binary.BigEndian, crc.Sum32())
+}
+
+// pngChunks splits an encoded PNG into its IHDR data and IDAT data.
+func pngChunks(data []byte) (ihdr []byte, idat []byte, err error) {
+	pos := len(apngSignature)
+	for pos+12 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if pos+12+size > len(data) {
+			break
+		}
+		chunk := data[pos+8 : pos+8+size]
+		switch chunkType {
+		case "IHDR":
+			ihdr = chunk
+		case "IDAT":
+			idat = append(idat, chunk...)
+		}
+		pos += 12 + size
+	}
+	if ihdr == nil || idat == nil {
+		return nil, nil, errors.New("apng: invalid png frame")
+	}
+	return ihdr, idat, nil
+}
+
+func (e *apngEncoder) writeFrame(img *image.RGBA, count int) error {
+	e.buf.Reset()
+	if err := e.encoder.Encode(&e.buf, img); err != nil {
+		return err
+	}
+	ihdr, idat, err := pngChunks(e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if e.ihdr == nil {
+		e.ihdr = append([]byte{}, ihdr...)
+		if _, err := e.w.WriteString(apngSignature); err != nil {
+			return err
+		}
+		if err := e.writeChunk("IHDR", e.ihdr); err != nil {
+			return err
+		}
+		// the number of frames is written by close
+		if err := e.writeChunk("acTL", make([]byte, 8)); err != nil {
+			return err
+		}
+	} else if !bytes.Equal(ihdr, e.ihdr) {
+		return errors.New("apng: frame format changed")
+	}
+
+	delay := e.clock.advance(count)
+	if delay > 0xFFFF {
+		delay = 0xFFFF
+	}
+
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], e.seq)
+	copy(fctl[4:12], ihdr[0:8]) // width, height
+	binary.BigEndian.PutUint16(fctl[20:], uint16(delay))
+	binary.BigEndian.PutUint16(fctl[22:], 1000)
+	e.seq++
+	if err := e.writeChunk("fcTL", fctl); err != nil {
+		return err
+	}
+
+	if e.frames == 0 {
+		err = e.writeChunk("IDAT", idat)
+	} else {
+		var seq [4]byte
+		binary.BigEndian.PutUint32(seq[:], e.seq)
+		err = e.writeChunk("fdAT", seq[:], idat)
+		e.seq++
+	}
+	if err != nil {
+		return err
+	}
+	e.frames++
+	return nil
+}
+
+func (e *apngEncoder) writeSamples(samples []float32) error {
+	return nil
+}
+
+func (e *apngEncoder) close() error {
+	if e.ihdr == nil {
+		return e.file.Close()
+	}
+
+	if err := e.writeChunk("IEND"); err != nil {
+		e.file.Close()
+		return err
+	}
+	if err := e.w.Flush(); err != nil {
+		e.file.Close()
+		return err
+	}
+
+	// acTL: number of frames, 0 (loop forever)
+	actl := make([]byte, 12)
+	binary.BigEndian.PutUint32(actl[0:], e.frames)
+	binary.BigEndian.PutUint32(actl[8:], crc32.ChecksumIEEE(append([]byte("acTL"), actl[:8]...)))
+	if _, err := e.file.WriteAt(actl, apngACTLData); err != nil {
+		e.file.Close()
+		return err
+	}
+	return e.file.Close()
+}
@@ -0,0 +1,336 @@
+// ORIGINAL
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+	"os"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+// Uncompressed AVI (AVI 1.0): 24-bit RGB frames and 16-bit PCM (mono or
+// interleaved stereo).
+// https://learn.microsoft.com/en-us/windows/win32/directshow/avi-riff-file-reference
+const (
+	aviMaxSize = math.MaxInt32 // AVI 1.0 readers use 32-bit signed offsets
+
+	aviHasIndex      = 0x10
+	aviIsInterleaved = 0x100
+	aviKeyFrame      = 0x10
+)
+
+var errAVITooLarge = errors.New("avi: file size limit (2GB) reached")
+
+type aviMainHeader struct {
+	MicroSecPerFrame    uint32
+	MaxBytesPerSec      uint32
+	PaddingGranularity  uint32
+	Flags               uint32
+	TotalFrames         uint32
+	InitialFrames       uint32
+	Streams             uint32
+	SuggestedBufferSize uint32
+	Width               uint32
+	Height              uint32
+	Reserved            [4]uint32
+}
+
+type aviStreamHeader struct {
+	Type                [4]byte
+	Handler             [4]byte
+	Flags               uint32
+	Priority            uint16
+	Language            uint16
+	InitialFrames       uint32
+	Scale               uint32
+	Rate                uint32
+	Start               uint32
+	Length              uint32
+	SuggestedBufferSize uint32
+	Quality             uint32
+	SampleSize          uint32
+	Frame               [4]int16
+}
+
+type aviBitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type aviWaveFormat struct {
+	FormatTag      uint16
+	Channels       uint16
+	SamplesPerSec  uint32
+	AvgBytesPerSec uint32
+	BlockAlign     uint16
+	BitsPerSample  uint16
+	Size           uint16
+}
+
+type aviIndexEntry struct {
+	ChunkID [4]byte
+	Flags   uint32
+	Offset  uint32
+	Size    uint32
+}
+
+type aviEncoder struct {
+	file       *os.File
+	w          *bufio.Writer
+	sampleRate int
+	channels   int
+
+	pos         int // current file offset
+	moviPos     int // offset of the movi list
+	index       []aviIndexEntry
+	frames      int
+	samples     int // audio sample frames (one sample per channel)
+	frame       []byte
+	audio       []byte
+	totalFrames int // offsets of the fields written by close
+	videoLength int
+	audioLength int
+}
+
+func newAVIEncoder(path string, sampleRate float64, channels int) (*aviEncoder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &aviEncoder{
+		file:       file,
+		w:          bufio.NewWriterSize(file, 1<<20),
+		sampleRate: int(sampleRate),
+		channels:   channels,
+	}, nil
+}
+
+// aviChunk appends a chunk and returns the offset of its data in buf.
+func aviChunk(buf *bytes.Buffer, id string, data interface{}) int {
+	buf.WriteString(id)
+	binary.Write(buf, binary.LittleEndian, uint32(binary.Size(data)))
+	pos := buf.Len()
+	binary.Write(buf, binary.LittleEndian, data)
+	return pos
+}
+
+// aviList appends a list whose content is written by f.
+func aviList(buf *bytes.Buffer, listType string, f func()) {
+	buf.WriteString("LIST")
+	sizePos := buf.Len()
+	buf.Write(make([]byte, 4))
+	buf.WriteString(listType)
+	f()
+	binary.LittleEndian.PutUint32(buf.Bytes()[sizePos:], uint32(buf.Len()-sizePos-4))
+}
+
+func (e *aviEncoder) writeHeader(width, height int) error {
+	frameSize := len(e.frame)
+	blockAlign := e.channels * 2
+	streams := 1
+	if e.sampleRate > 0 {
+		streams = 2
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("RIFF")
+	buf.Write(make([]byte, 4)) // written by close
+	buf.WriteString("AVI ")
+	aviList(buf, "hdrl", func() {
+		pos := aviChunk(buf, "avih", &aviMainHeader{
+			MicroSecPerFrame:    1000000 * frameRateDen / frameRateNum,
+			MaxBytesPerSec:      uint32(float64(frameSize)*chibines.FrameRate) + uint32(e.sampleRate*blockAlign),
+			Flags:               aviHasIndex | aviIsInterleaved,
+			Streams:             uint32(streams),
+			SuggestedBufferSize: uint32(frameSize),
+			Width:               uint32(width),
+			Height:              uint32(height),
+		})
+		e.totalFrames = pos + 16
+
+		aviList(buf, "strl", func() {
+			pos := aviChunk(buf, "strh", &aviStreamHeader{
+				Type:                [4]byte{'v', 'i', 'd', 's'},
+				Handler:             [4]byte{'D', 'I', 'B', ' '},
+				Scale:               frameRateDen,
+				Rate:                frameRateNum,
+				SuggestedBufferSize: uint32(frameSize),
+				Quality:             math.MaxUint32,
+				Frame:               [4]int16{0, 0, int16(width), int16(height)},
+			})
+			e.videoLength = pos + 32
+			aviChunk(buf, "strf", &aviBitmapInfoHeader{
+				Size:      40,
+				Width:     int32(width),
+				Height:    int32(height), // bottom-up
+				Planes:    1,
+				BitCount:  24,
+				SizeImage: uint32(frameSize),
+			})
+		})
+
+		if e.sampleRate > 0 {
+			aviList(buf, "strl", func() {
+				pos := aviChunk(buf, "strh", &aviStreamHeader{
+					Type:                [4]byte{'a', 'u', 'd', 's'},
+					Scale:               uint32(blockAlign),
+					Rate:                uint32(e.sampleRate * blockAlign),
+					SuggestedBufferSize: uint32(e.sampleRate * blockAlign / 20),
+					Quality:             math.MaxUint32,
+					SampleSize:          uint32(blockAlign),
+				})
+				e.audioLength = pos + 32
+				aviChunk(buf, "strf", &aviWaveFormat{
+					FormatTag:      1, // PCM
+					Channels:       uint16(e.channels),
+					SamplesPerSec:  uint32(e.sampleRate),
+					AvgBytesPerSec: uint32(e.sampleRate * blockAlign),
+					BlockAlign:     uint16(blockAlign),
+					BitsPerSample:  16,
+				})
+			})
+		}
+	})
+
+	// the size of movi is written by close
+	e.moviPos = buf.Len()
+	buf.WriteString("LIST")
+	buf.Write(make([]byte, 4))
+	buf.WriteString("movi")
+
+	e.pos = buf.Len()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *aviEncoder) writeChunk(id string, data []byte) error {
+	padding := len(data) & 1
+	indexSize := 8 + (len(e.index)+1)*16
+	if e.pos+8+len(data)+padding+indexSize > aviMaxSize {
+		return errAVITooLarge
+	}
+
+	e.index = append(e.index, aviIndexEntry{
+		Flags:  aviKeyFrame,
+		Offset: uint32(e.pos - e.moviPos - 8), // from "movi"
+		Size:   uint32(len(data)),
+	})
+	copy(e.index[len(e.index)-1].ChunkID[:], id)
+
+	var header [8]byte
+	copy(header[:], id)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(data); err != nil {
+		return err
+	}
+	if padding != 0 {
+		if err := e.w.WriteByte(0); err != nil {
+			return err
+		}
+	}
+	e.pos += 8 + len(data) + padding
+	return nil
+}
+
+func (e *aviEncoder) writeFrame(img *image.RGBA, count int) error {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	stride := (width*3 + 3) &^ 3
+	if e.frame == nil {
+		e.frame = make([]byte, stride*height)
+		if err := e.writeHeader(width, height); err != nil {
+			return err
+		}
+	}
+
+	// BGR, bottom-up
+	for y := 0; y < height; y++ {
+		row := e.frame[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			row[x*3] = img.Pix[i+2]
+			row[x*3+1] = img.Pix[i+1]
+			row[x*3+2] = img.Pix[i]
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if err := e.writeChunk("00db", e.frame); err != nil {
+			return err
+		}
+		e.frames++
+	}
+	return nil
+}
+
+func (e *aviEncoder) writeSamples(samples []float32) error {
+	// the header is written with the first frame
+	if e.sampleRate == 0 || e.frame == nil || len(samples) == 0 {
+		return nil
+	}
+	e.audio = chibines.AppendPCM16(e.audio[:0], samples)
+	if err := e.writeChunk("01wb", e.audio); err != nil {
+		return err
+	}
+	e.samples += len(samples) / e.channels
+	return nil
+}
+
+func (e *aviEncoder) close() error {
+	if e.frame == nil {
+		// no frame
+		return e.file.Close()
+	}
+
+	moviSize := e.pos - e.moviPos - 8
+	if _, err := e.w.WriteString("idx1"); err != nil {
+		e.file.Close()
+		return err
+	}
+	binary.Write(e.w, binary.LittleEndian, uint32(len(e.index)*16))
+	if err := binary.Write(e.w, binary.LittleEndian, e.index); err != nil {
+		e.file.Close()
+		return err
+	}
+	fileSize := e.pos + 8 + len(e.index)*16
+	if err := e.w.Flush(); err != nil {
+		e.file.Close()
+		return err
+	}
+
+	// offset, value
+	patches := [][2]int{
+		{4, fileSize - 8},
+		{e.totalFrames, e.frames},
+		{e.videoLength, e.frames},
+		{e.moviPos + 4, moviSize},
+	}
+	if e.sampleRate > 0 {
+		patches = append(patches, [2]int{e.audioLength, e.samples})
+	}
+	for _, p := range patches {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(p[1]))
+		if _, err := e.file.WriteAt(b[:], int64(p[0])); err != nil {
+			e.file.Close()
+			return err
+		}
+	}
+	return e.file.Close()
+}
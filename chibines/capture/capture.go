@@ -0,0 +1,101 @@
+// ORIGINAL
+
+// Package capture saves screenshots and records video with audio.
+//
+// A Recorder takes the frames of the screen (e.g. the output of
+// video.Renderer) and the audio samples of the APU on the emulation thread,
+// and encodes them on another goroutine:
+//
+//	recorder, err := capture.NewRecorder("clip.avi", sampleRate, console.AudioChannels())
+//	console.SetAudioRecorder(recorder.WriteSample)
+//	for ... {
+//		console.StepFrame()
+//		recorder.WriteFrame(renderer.Render(console.Buffer()))
+//	}
+//	console.SetAudioRecorder(nil)
+//	err = recorder.Close()
+package capture
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+// chibines.FrameRate as a fraction for the containers: frameRateNum /
+// frameRateDen (2 CPU clocks / 59561 cycles per 2 frames)
+const (
+	frameRateNum = chibines.CPUFrequency * 2
+	frameRateDen = 59561
+)
+
+// Recording formats, selected by the file extension.
+const (
+	FormatY4M  = "y4m"  // YUV4MPEG2 4:4:4 video, audio in a .wav beside it
+	FormatAVI  = "avi"  // uncompressed RGB video and 16-bit PCM audio
+	FormatGIF  = "gif"  // animated GIF (no audio), kept in memory until Close
+	FormatAPNG = "apng" // animated PNG (no audio), written as .png
+)
+
+// Formats returns the recording formats.
+func Formats() []string {
+	return []string{FormatY4M, FormatAVI, FormatGIF, FormatAPNG}
+}
+
+// formatExtension returns the file extension of format.
+func formatExtension(format string) string {
+	if format == FormatAPNG {
+		return ".png"
+	}
+	return "." + format
+}
+
+// formatOf returns the format of path from its extension.
+func formatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".y4m":
+		return FormatY4M, nil
+	case ".avi":
+		return FormatAVI, nil
+	case ".gif":
+		return FormatGIF, nil
+	case ".png", ".apng":
+		return FormatAPNG, nil
+	}
+	return "", fmt.Errorf("unknown recording format: %s", path)
+}
+
+// TimestampPath returns dir/prefix-YYYYMMDD-hhmmss.mmm with the extension
+// of format ("png" for screenshots).
+func TimestampPath(dir, prefix, format string) string {
+	name := fmt.Sprintf("%s-%s", prefix, time.Now().Format("20060102-150405.000"))
+	if format == "png" {
+		return filepath.Join(dir, name+".png")
+	}
+	return filepath.Join(dir, name+formatExtension(format))
+}
+
+// SaveScreenshot writes img to path as PNG.
+func SaveScreenshot(path string, img image.Image) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
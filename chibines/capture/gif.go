@@ -0,0 +1,93 @@
+// ORIGINAL
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+)
+
+// Animated GIF. image/gif can only encode a whole animation, so the frames
+// are kept in memory (paletted) until close: for short clips.
+type gifEncoder struct {
+	file   *os.File
+	clock  frameClock
+	images []*image.Paletted
+	delays []int
+}
+
+func newGIFEncoder(path string) (*gifEncoder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &gifEncoder{
+		file:  file,
+		clock: frameClock{unit: 100},
+	}, nil
+}
+
+func (e *gifEncoder) writeFrame(img *image.RGBA, count int) error {
+	delay := e.clock.advance(count)
+
+	// most viewers show delays < 2 (1/100s) slowly: extend the previous
+	// frame instead (about 30 fps)
+	if delay < 2 && len(e.images) > 0 {
+		e.delays[len(e.delays)-1] += delay
+		return nil
+	}
+
+	e.images = append(e.images, toPaletted(img))
+	e.delays = append(e.delays, delay)
+	return nil
+}
+
+func (e *gifEncoder) writeSamples(samples []float32) error {
+	return nil
+}
+
+func (e *gifEncoder) close() error {
+	if len(e.images) == 0 {
+		return e.file.Close()
+	}
+	err := gif.EncodeAll(e.file, &gif.GIF{
+		Image: e.images,
+		Delay: e.delays,
+	})
+	if err != nil {
+		e.file.Close()
+		return err
+	}
+	return e.file.Close()
+}
+
+// toPaletted converts img with its own colors when it has 256 colors or
+// less (the NES screen without filters), else with dithering.
+func toPaletted(img *image.RGBA) *image.Paletted {
+	bounds := img.Rect
+	dst := image.NewPaletted(bounds, nil)
+
+	indexes := map[uint32]uint8{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			c := uint32(img.Pix[i])<<16 | uint32(img.Pix[i+1])<<8 | uint32(img.Pix[i+2])
+			index, ok := indexes[c]
+			if !ok {
+				if len(dst.Palette) == 256 {
+					dst.Palette = palette.Plan9
+					draw.FloydSteinberg.Draw(dst, bounds, img, bounds.Min)
+					return dst
+				}
+				index = uint8(len(dst.Palette))
+				indexes[c] = index
+				dst.Palette = append(dst.Palette, color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], 0xFF})
+			}
+			dst.Pix[dst.PixOffset(x, y)] = index
+		}
+	}
+	return dst
+}
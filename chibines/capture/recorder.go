@@ -0,0 +1,241 @@
+// ORIGINAL
+package capture
+
+import (
+	"image"
+	"math"
+	"sync"
+
+	"github.com/kaishuu0123/chibines/chibines"
+	"golang.org/x/image/draw"
+)
+
+// frames waiting for the encoder (2 seconds)
+const recorderQueueSize = 120
+
+// encoder writes a recording format.
+type encoder interface {
+	// writeFrame writes img, shown for count frames (count >= 1).
+	writeFrame(img *image.RGBA, count int) error
+	writeSamples(samples []float32) error
+	close() error
+}
+
+type recorderFrame struct {
+	img     *image.RGBA
+	samples []float32 // audio since the previous frame
+}
+
+// Recorder records frames and audio samples to a file. WriteSample and
+// WriteFrame are called from the emulation thread and never block: the
+// encoding runs on its own goroutine.
+//
+// The video is timed by the audio: each frame lasts until the next one in
+// audio samples, so the recording stays in sync whatever the rate of
+// WriteFrame (a frame is repeated or skipped as needed).
+type Recorder struct {
+	path       string
+	sampleRate float64
+	channels   int
+
+	frames    chan *recorderFrame
+	free      chan *recorderFrame
+	allocated int
+	samples   []float32
+	dropped   int
+
+	done chan struct{}
+	mu   sync.Mutex
+	err  error
+}
+
+// NewRecorder creates a recording to path. The format is chosen by the
+// extension (see Formats). sampleRate is the audio sample rate of the
+// console (0 without audio: every frame then lasts 1/chibines.FrameRate)
+// and channels the number of interleaved audio channels (1 or 2).
+func NewRecorder(path string, sampleRate float64, channels int) (*Recorder, error) {
+	format, err := formatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	if channels < 1 {
+		channels = 1
+	}
+
+	var enc encoder
+	switch format {
+	case FormatY4M:
+		enc, err = newY4MEncoder(path, sampleRate, channels)
+	case FormatAVI:
+		enc, err = newAVIEncoder(path, sampleRate, channels)
+	case FormatGIF:
+		enc, err = newGIFEncoder(path)
+	case FormatAPNG:
+		enc, err = newAPNGEncoder(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		path:       path,
+		sampleRate: sampleRate,
+		channels:   channels,
+		frames:     make(chan *recorderFrame, recorderQueueSize),
+		free:       make(chan *recorderFrame, recorderQueueSize),
+		done:       make(chan struct{}),
+	}
+	go r.run(enc)
+	return r, nil
+}
+
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Dropped returns the number of frames dropped because the encoder was
+// behind.
+func (r *Recorder) Dropped() int {
+	return r.dropped
+}
+
+// Err returns the error of the encoder, if it failed.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// WriteSample adds an audio sample (see Console.SetAudioRecorder).
+func (r *Recorder) WriteSample(sample float32) {
+	r.samples = append(r.samples, sample)
+}
+
+// WriteFrame queues a copy of img with the audio samples written since the
+// previous frame. When the queue is full the frame is dropped (its samples
+// go with the next frame). It returns the error of the encoder once it has
+// failed.
+func (r *Recorder) WriteFrame(img *image.RGBA) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	var f *recorderFrame
+	select {
+	case f = <-r.free:
+	default:
+		if r.allocated == recorderQueueSize {
+			r.dropped++
+			return nil
+		}
+		f = &recorderFrame{}
+		r.allocated++
+	}
+
+	// at most recorderQueueSize frames exist, so this does not block
+	f.img = copyImage(f.img, img)
+	f.samples = append(f.samples[:0], r.samples...)
+	r.samples = r.samples[:0]
+	r.frames <- f
+	return nil
+}
+
+// Close writes the queued frames and finishes the file.
+func (r *Recorder) Close() error {
+	close(r.frames)
+	<-r.done
+	return r.Err()
+}
+
+func (r *Recorder) run(enc encoder) {
+	defer close(r.done)
+
+	var size image.Point
+	var scaled *image.RGBA
+	totalSamples := 0
+	written := 0
+	for f := range r.frames {
+		if r.Err() != nil {
+			continue
+		}
+
+		count := 1
+		if r.sampleRate > 0 {
+			totalSamples += len(f.samples) / r.channels
+			count = int(math.Round(float64(totalSamples)/r.sampleRate*chibines.FrameRate)) - written
+		}
+
+		img := f.img
+		if written == 0 {
+			size = img.Rect.Size()
+		} else if img.Rect.Size() != size {
+			// the filter changed: keep the size of the first frame
+			if scaled == nil {
+				scaled = image.NewRGBA(image.Rectangle{Max: size})
+			}
+			draw.NearestNeighbor.Scale(scaled, scaled.Rect, img, img.Rect, draw.Src, nil)
+			img = scaled
+		}
+
+		if written == 0 && count < 1 {
+			// the first frame starts the file
+			count = 1
+		}
+
+		var err error
+		if count > 0 {
+			err = enc.writeFrame(img, count)
+			written += count
+		}
+		if err == nil {
+			err = enc.writeSamples(f.samples)
+		}
+		if err != nil {
+			r.setErr(err)
+		}
+		r.free <- f
+	}
+
+	if err := enc.close(); err != nil {
+		r.setErr(err)
+	}
+}
+
+// copyImage copies src to dst (reallocated if the size differs), with
+// bounds starting at (0, 0).
+func copyImage(dst *image.RGBA, src *image.RGBA) *image.RGBA {
+	size := src.Rect.Size()
+	if dst == nil || dst.Rect.Size() != size {
+		dst = image.NewRGBA(image.Rectangle{Max: size})
+	}
+	for y := 0; y < size.Y; y++ {
+		i := src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y)
+		copy(dst.Pix[y*dst.Stride:y*dst.Stride+size.X*4], src.Pix[i:i+size.X*4])
+	}
+	return dst
+}
+
+// frameClock converts frame counts to a time base (e.g. 100 for GIF
+// delays) without accumulating rounding errors.
+type frameClock struct {
+	unit   float64
+	frames int
+	time   int
+}
+
+// advance adds count frames and returns their duration.
+func (c *frameClock) advance(count int) int {
+	c.frames += count
+	end := int(math.Round(float64(c.frames) * c.unit / chibines.FrameRate))
+	d := end - c.time
+	c.time = end
+	return d
+}
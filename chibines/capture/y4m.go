@@ -0,0 +1,108 @@
+// ORIGINAL
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+// YUV4MPEG2 with 4:4:4 sampling (no chroma loss) and BT.601 colors.
+// The audio is written to a .wav file with the same name.
+// https://wiki.multimedia.cx/index.php/YUV4MPEG2
+type y4mEncoder struct {
+	file   *os.File
+	w      *bufio.Writer
+	wav    *chibines.WAVWriter
+	header bool
+	frame  []byte
+}
+
+func newY4MEncoder(path string, sampleRate float64, channels int) (*y4mEncoder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &y4mEncoder{
+		file: file,
+		w:    bufio.NewWriterSize(file, 1<<20),
+	}
+	if sampleRate > 0 {
+		wavPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".wav"
+		e.wav, err = chibines.NewWAVWriter(wavPath, int(sampleRate), channels)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *y4mEncoder) writeFrame(img *image.RGBA, count int) error {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if !e.header {
+		_, err := fmt.Fprintf(e.w, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C444\n", width, height, frameRateNum, frameRateDen)
+		if err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	planeSize := width * height
+	if len(e.frame) != planeSize*3 {
+		e.frame = make([]byte, planeSize*3)
+	}
+	yPlane := e.frame[:planeSize]
+	uPlane := e.frame[planeSize : planeSize*2]
+	vPlane := e.frame[planeSize*2:]
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			r := int(img.Pix[i])
+			g := int(img.Pix[i+1])
+			b := int(img.Pix[i+2])
+			j := y*width + x
+			yPlane[j] = byte(((66*r + 129*g + 25*b + 128) >> 8) + 16)
+			uPlane[j] = byte(((-38*r - 74*g + 112*b + 128) >> 8) + 128)
+			vPlane[j] = byte(((112*r - 94*g - 18*b + 128) >> 8) + 128)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if _, err := e.w.WriteString("FRAME\n"); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(e.frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *y4mEncoder) writeSamples(samples []float32) error {
+	if e.wav == nil {
+		return nil
+	}
+	return e.wav.WriteSamples(samples)
+}
+
+func (e *y4mEncoder) close() error {
+	var wavErr error
+	if e.wav != nil {
+		wavErr = e.wav.Close()
+	}
+	if err := e.w.Flush(); err != nil {
+		e.file.Close()
+		return err
+	}
+	if err := e.file.Close(); err != nil {
+		return err
+	}
+	return wavErr
+}
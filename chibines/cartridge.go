@@ -13,6 +13,7 @@ type Cartridge struct {
 	Mirror   byte    // mirroring mode
 	Battery  byte    // battery present
 	EEPROM   *EEPROM // Save EEPROM
+	Trainer  []byte  // 512-byte trainer (nil if not present)
 
 	// Meta data (from iNES header)
 	ROMFilePath string
@@ -85,3 +86,7 @@ func (c *Cartridge) Close() {
 func (c *Cartridge) HasBattery() bool {
 	return c.Battery == 1
 }
+
+func (c *Cartridge) HasTrainer() bool {
+	return len(c.Trainer) == TRAINER_SIZE
+}
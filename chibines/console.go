@@ -12,11 +12,19 @@ type Console struct {
 	Cartridge   *Cartridge
 	Controller1 *Controller
 	Controller2 *Controller
+	Controller3 *Controller // for 4-player adapters
+	Controller4 *Controller // for 4-player adapters
 
 	disableOCnextFrame bool
 }
 
 func NewConsole(path string, isNSF bool) (*Console, error) {
+	return NewConsoleWithPatch(path, "", isNSF)
+}
+
+// NewConsoleWithPatch creates a console with the given patch (.ips, .ups, .bps)
+// applied to the ROM in memory. patchPath is ignored for NSF files.
+func NewConsoleWithPatch(path string, patchPath string, isNSF bool) (*Console, error) {
 	controller1 := NewController()
 	controller2 := NewController()
 	console := Console{
@@ -26,6 +34,8 @@ func NewConsole(path string, isNSF bool) (*Console, error) {
 		Cartridge:   nil,
 		Controller1: controller1,
 		Controller2: controller2,
+		Controller3: NewController(),
+		Controller4: NewController(),
 	}
 	console.CPU = NewCPU(&console)
 	console.APU = NewAPU(&console)
@@ -39,7 +49,7 @@ func NewConsole(path string, isNSF bool) (*Console, error) {
 			return nil, err
 		}
 	} else {
-		cartridge, err = LoadNESFile(path, &console)
+		cartridge, err = LoadNESFileWithPatch(path, patchPath, &console)
 		if err != nil {
 			return nil, err
 		}
@@ -100,6 +110,24 @@ func (console *Console) Buffer() *image.RGBA {
 	return console.PPU.front
 }
 
+// OutputBuffer returns the last frame as 256x240 9-bit pixels
+// (emphasis << 6 | palette index), e.g. for NTSC filters.
+func (console *Console) OutputBuffer() []uint16 {
+	return console.PPU.OutputBuffer()
+}
+
+// SetPalette sets the palette used to render the screen (nil = DefaultPalette).
+func (console *Console) SetPalette(palette *Palette) {
+	if palette == nil {
+		palette = DefaultPalette
+	}
+	console.PPU.palette = palette
+}
+
+func (console *Console) Palette() *Palette {
+	return console.PPU.palette
+}
+
 func (console *Console) SetButtons1(buttons [8]bool) {
 	console.Controller1.SetButtons(buttons)
 }
@@ -108,23 +136,147 @@ func (console *Console) SetButtons2(buttons [8]bool) {
 	console.Controller2.SetButtons(buttons)
 }
 
-func (console *Console) SetAudioChannel(channel chan float32) {
-	console.APU.channel = channel
+func (console *Console) SetButtons3(buttons [8]bool) {
+	console.Controller3.SetButtons(buttons)
+}
+
+func (console *Console) SetButtons4(buttons [8]bool) {
+	console.Controller4.SetButtons(buttons)
+}
+
+// SetZapper connects a Zapper to port 1 or 2 (if not connected yet) and
+// updates its aimed pixel and trigger. Use negative x, y to aim off-screen.
+func (console *Console) SetZapper(port int, x, y int, trigger bool) {
+	zapper, ok := console.InputDevice(port).(*Zapper)
+	if !ok {
+		zapper = NewZapper(console.PPU)
+		console.SetInputDevice(port, zapper)
+	}
+	zapper.SetState(x, y, trigger)
+}
+
+// DisconnectZapper reconnects the standard controller to port 1 or 2.
+func (console *Console) DisconnectZapper(port int) {
+	if _, ok := console.InputDevice(port).(*Zapper); !ok {
+		return
+	}
+	switch port {
+	case InputPort1:
+		console.SetInputDevice(port, console.Controller1)
+	case InputPort2:
+		console.SetInputDevice(port, console.Controller2)
+	}
+}
+
+// AudioBuffer returns the buffer receiving the audio samples (at the rate
+// set by SetAudioSampleRate).
+func (console *Console) AudioBuffer() *AudioBuffer {
+	return console.APU.buffer
+}
+
+// ReadSamples moves up to len(out) audio samples to out and returns their
+// number (see AudioBuffer.ReadSamples). In stereo the samples are interleaved
+// (left, right): len(out) must be even.
+func (console *Console) ReadSamples(out []float32) int {
+	return console.APU.buffer.ReadSamples(out)
+}
+
+// SetAudioStereo enables the stereo output, with the channels panned by
+// APU.SetChannelPan or APU.SetPanningPreset.
+func (console *Console) SetAudioStereo(stereo bool) {
+	console.APU.SetStereo(stereo)
+}
+
+// AudioChannels returns the number of interleaved audio channels of the
+// samples: 1 (mono) or 2 (stereo).
+func (console *Console) AudioChannels() int {
+	return console.APU.Channels()
+}
+
+// SetAudioRecorder sets a function called with every audio sample (after
+// the filters, interleaved in stereo), e.g. capture.Recorder.WriteSample.
+// nil removes it.
+func (console *Console) SetAudioRecorder(recorder func(sample float32)) {
+	console.APU.recorder = recorder
+}
+
+// SetStemRecorder sets a function called at every audio sample with the
+// sample of each channel alone (indexed by APUChannel), aligned with the
+// samples of SetAudioRecorder: e.g. to write one WAV file per channel. nil
+// removes it.
+func (console *Console) SetStemRecorder(recorder func(samples []float32)) {
+	console.APU.SetStemRecorder(recorder)
+}
+
+// SetAPURegisterLogger logs the writes to the APU registers, e.g. to a
+// vgm.Writer. nil stops the log (see APURegisterLogger.EndLog).
+func (console *Console) SetAPURegisterLogger(logger APURegisterLogger) {
+	console.APU.SetRegisterLogger(logger)
 }
 
 func (console *Console) SetAudioSampleRate(sampleRate float64) {
 	if sampleRate != 0 {
 		// Convert samples per second to cpu steps per sample
 		console.APU.sampleRate = CPUFrequency / sampleRate
-		// Initialize filters
-		console.APU.filterChain = APUFilterChain{
-			HighPassFilter(float32(sampleRate), 90),
-			HighPassFilter(float32(sampleRate), 440),
-			LowPassFilter(float32(sampleRate), 14000),
+		console.APU.baseSampleRate = console.APU.sampleRate
+		// Initialize filters (one chain per side)
+		for i := range console.APU.filterChain {
+			console.APU.filterChain[i] = newAPUFilterChain(sampleRate)
 		}
 	} else {
-		console.APU.filterChain = nil
+		console.APU.filterChain = [2]APUFilterChain{}
+	}
+	if console.APU.stems != nil {
+		console.APU.stems.init(console.APU)
+	}
+}
+
+// newAPUFilterChain returns the filters of the NES audio output: high-pass
+// at 90Hz and 440Hz, low-pass at 14kHz.
+func newAPUFilterChain(sampleRate float64) APUFilterChain {
+	if sampleRate == 0 {
+		return nil
+	}
+	return APUFilterChain{
+		HighPassFilter(float32(sampleRate), 90),
+		HighPassFilter(float32(sampleRate), 440),
+		LowPassFilter(float32(sampleRate), 14000),
+	}
+}
+
+// SetAudioQuality selects the sample rate conversion (AudioQualityMedium by
+// default). Higher qualities remove aliasing but cost more CPU.
+func (console *Console) SetAudioQuality(quality AudioQuality) {
+	console.APU.SetQuality(quality)
+}
+
+// SetAudioRateControl enables dynamic rate control: every frame, the sample
+// rate is adjusted by up to maxDelta (e.g. 0.005 = 0.5%) to keep about
+// target samples in the audio buffer (counting both sides in stereo). This
+// absorbs the difference between the emulation speed (e.g. one frame per
+// vsync) and the audio clock without underruns or overruns. After an
+// underrun the audio buffer waits for target samples again (see
+// AudioBuffer.SetPrefill). maxDelta = 0 disables it.
+func (console *Console) SetAudioRateControl(target int, maxDelta float64) {
+	apu := console.APU
+	if target <= 0 || target > apu.buffer.Cap() {
+		target = apu.buffer.Cap() / 2
+	}
+	apu.rateControlTarget = target
+	apu.buffer.SetPrefill(target)
+	apu.rateControlMaxDelta = maxDelta
+	if maxDelta == 0 && apu.baseSampleRate != 0 {
+		apu.sampleRate = apu.baseSampleRate
+	}
+}
+
+// AudioRateRatio returns the current sample rate adjustment of the dynamic
+// rate control (1.0 = none).
+func (console *Console) AudioRateRatio() float64 {
+	if console.APU.sampleRate == 0 {
+		return 1
 	}
+	return console.APU.baseSampleRate / console.APU.sampleRate
 }
 
 // XXX: really need?
@@ -26,7 +26,18 @@ func (c *Controller) SetButtons(buttons [8]bool) {
 	c.buttons = buttons
 }
 
-func (c *Controller) Read() byte {
+// state returns the buttons in report order (bit 0 = A ... bit 7 = Right).
+func (c *Controller) state() byte {
+	var value byte
+	for i := 0; i < 8; i++ {
+		if c.buttons[i] {
+			value |= 1 << i
+		}
+	}
+	return value
+}
+
+func (c *Controller) Read(address uint16) byte {
 	value := byte(0)
 	if c.index < 8 && c.buttons[c.index] {
 		value = 1
@@ -35,7 +46,7 @@ func (c *Controller) Read() byte {
 	if c.strobe&1 == 1 {
 		c.index = 0
 	}
-	return value | 0x40
+	return value
 }
 
 func (c *Controller) Write(value byte) {
@@ -44,3 +55,6 @@ func (c *Controller) Write(value byte) {
 		c.index = 0
 	}
 }
+
+func (c *Controller) UpdateFrame() {
+}
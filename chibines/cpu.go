@@ -8,6 +8,9 @@ import (
 
 const CPUFrequency = 1789773
 
+// FrameRate is the NTSC frame rate (29780.5 CPU cycles per frame).
+const FrameRate = CPUFrequency / 29780.5
+
 const (
 	NMIVector      uint16 = 0xFFFA
 	ResetVector    uint16 = 0xFFFC
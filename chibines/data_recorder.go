@@ -0,0 +1,154 @@
+// refs: github.com/libretro/Mesen
+package chibines
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Family BASIC Data Recorder
+// https://www.nesdev.org/wiki/Family_BASIC_Data_Recorder
+//
+// $4016 write: bit 0 = tape output, bit 2 = enable
+// $4016 read:  D1 = tape input
+const dataRecorderCyclesPerSample = 88
+
+// DataRecorderSampleRate is the sample rate of the tape (one bit per sample).
+const DataRecorderSampleRate = CPUFrequency / dataRecorderCyclesPerSample
+
+type DataRecorder struct {
+	console *Console
+
+	data      []byte // one bit per sample (0 or 1)
+	playing   bool
+	recording bool
+	cycle     uint64
+	enabled   bool
+	output    byte // tape output (bit 0 of the last $4016 write)
+}
+
+func NewDataRecorder(console *Console) *DataRecorder {
+	return &DataRecorder{
+		console: console,
+	}
+}
+
+func (d *DataRecorder) IsPlaying() bool {
+	return d.playing
+}
+
+func (d *DataRecorder) IsRecording() bool {
+	return d.recording
+}
+
+// Play starts playing the loaded tape from the beginning.
+func (d *DataRecorder) Play() {
+	d.recording = false
+	d.playing = len(d.data) > 0
+	d.cycle = d.console.CPU.cycleCount
+}
+
+// Record clears the tape and starts recording.
+func (d *DataRecorder) Record() {
+	d.playing = false
+	d.recording = true
+	d.data = nil
+	d.cycle = d.console.CPU.cycleCount
+}
+
+func (d *DataRecorder) Stop() {
+	d.playing = false
+	d.recording = false
+}
+
+// Data returns the tape contents (one bit per sample).
+func (d *DataRecorder) Data() []byte {
+	return d.data
+}
+
+func (d *DataRecorder) SetData(data []byte) {
+	d.Stop()
+	d.data = data
+}
+
+func (d *DataRecorder) Read() byte {
+	if !d.playing {
+		return 0
+	}
+
+	pos := (d.console.CPU.cycleCount - d.cycle) / dataRecorderCyclesPerSample
+	if pos >= uint64(len(d.data)) {
+		d.playing = false
+		return 0
+	}
+	if !d.enabled {
+		return 0
+	}
+	return (d.data[pos] & 0x01) << 1
+}
+
+func (d *DataRecorder) Write(value byte) {
+	d.enabled = (value & 0x04) == 0x04
+
+	if d.recording {
+		// the output held the previous bit until this write
+		for d.console.CPU.cycleCount-d.cycle >= dataRecorderCyclesPerSample {
+			d.data = append(d.data, d.output)
+			d.cycle += dataRecorderCyclesPerSample
+		}
+	}
+	d.output = value & 0x01
+}
+
+// Load loads a tape from a .wav file (PCM) or a raw bit file
+// (one byte per sample at DataRecorderSampleRate).
+func (d *DataRecorder) Load(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".wav") {
+		d.SetData(raw)
+		return nil
+	}
+
+	wav, err := decodeWAV(raw)
+	if err != nil {
+		return err
+	}
+
+	// resample (nearest) the first channel and slice at zero
+	frames := len(wav.Samples) / wav.Channels
+	length := int(int64(frames) * DataRecorderSampleRate / int64(wav.SampleRate))
+	data := make([]byte, length)
+	for i := range data {
+		frame := int(int64(i) * int64(wav.SampleRate) / DataRecorderSampleRate)
+		if wav.Samples[frame*wav.Channels] > 0 {
+			data[i] = 1
+		}
+	}
+	d.SetData(data)
+
+	return nil
+}
+
+// Save writes the tape to a .wav file (8-bit mono PCM) or a raw bit file.
+func (d *DataRecorder) Save(path string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".wav") {
+		return os.WriteFile(path, d.data, 0644)
+	}
+
+	pcm := make([]byte, len(d.data))
+	for i, v := range d.data {
+		if v&0x01 == 0x01 {
+			pcm[i] = 0xC0
+		} else {
+			pcm[i] = 0x40
+		}
+	}
+
+	header := newWAVHeader(DataRecorderSampleRate, 1, 8, uint32(len(pcm)))
+	return os.WriteFile(path, append(header.Bytes(), pcm...), 0644)
+}
@@ -0,0 +1,176 @@
+// refs: github.com/libretro/Mesen
+package chibines
+
+// Family BASIC Keyboard
+// https://www.nesdev.org/wiki/Family_BASIC_Keyboard
+//
+// $4016 write: bit 0 = reset to row 0, bit 1 = column select, bit 2 = enable
+// $4017 read:  D1-D4 = keys of the selected row/column (active low)
+//
+// Keys are numbered in matrix order: row * 8 + column * 4 + bit (D1-D4).
+type FamilyBasicKey int
+
+const (
+	// Row 0
+	FamilyBasicKeyRightBracket FamilyBasicKey = iota
+	FamilyBasicKeyLeftBracket
+	FamilyBasicKeyReturn
+	FamilyBasicKeyF8
+	FamilyBasicKeyStop
+	FamilyBasicKeyYen
+	FamilyBasicKeyRightShift
+	FamilyBasicKeyKana
+	// Row 1
+	FamilyBasicKeySemicolon
+	FamilyBasicKeyColon
+	FamilyBasicKeyAt
+	FamilyBasicKeyF7
+	FamilyBasicKeyCaret
+	FamilyBasicKeyMinus
+	FamilyBasicKeySlash
+	FamilyBasicKeyUnderscore
+	// Row 2
+	FamilyBasicKeyK
+	FamilyBasicKeyL
+	FamilyBasicKeyO
+	FamilyBasicKeyF6
+	FamilyBasicKey0
+	FamilyBasicKeyP
+	FamilyBasicKeyComma
+	FamilyBasicKeyPeriod
+	// Row 3
+	FamilyBasicKeyJ
+	FamilyBasicKeyU
+	FamilyBasicKeyI
+	FamilyBasicKeyF5
+	FamilyBasicKey8
+	FamilyBasicKey9
+	FamilyBasicKeyN
+	FamilyBasicKeyM
+	// Row 4
+	FamilyBasicKeyH
+	FamilyBasicKeyG
+	FamilyBasicKeyY
+	FamilyBasicKeyF4
+	FamilyBasicKey6
+	FamilyBasicKey7
+	FamilyBasicKeyV
+	FamilyBasicKeyB
+	// Row 5
+	FamilyBasicKeyD
+	FamilyBasicKeyR
+	FamilyBasicKeyT
+	FamilyBasicKeyF3
+	FamilyBasicKey4
+	FamilyBasicKey5
+	FamilyBasicKeyC
+	FamilyBasicKeyF
+	// Row 6
+	FamilyBasicKeyA
+	FamilyBasicKeyS
+	FamilyBasicKeyW
+	FamilyBasicKeyF2
+	FamilyBasicKey3
+	FamilyBasicKeyE
+	FamilyBasicKeyZ
+	FamilyBasicKeyX
+	// Row 7
+	FamilyBasicKeyControl
+	FamilyBasicKeyQ
+	FamilyBasicKeyEscape
+	FamilyBasicKeyF1
+	FamilyBasicKey2
+	FamilyBasicKey1
+	FamilyBasicKeyGrph
+	FamilyBasicKeyLeftShift
+	// Row 8
+	FamilyBasicKeyLeft
+	FamilyBasicKeyRight
+	FamilyBasicKeyUp
+	FamilyBasicKeyClrHome
+	FamilyBasicKeyIns
+	FamilyBasicKeyDel
+	FamilyBasicKeySpace
+	FamilyBasicKeyDown
+
+	FamilyBasicKeyCount
+)
+
+const familyBasicKeyboardRows = 9
+
+// FamilyBasicKeyboard is the Family BASIC keyboard (HVC-007) for the
+// Famicom expansion port. The data recorder is connected through it.
+type FamilyBasicKeyboard struct {
+	keys    [FamilyBasicKeyCount]bool
+	row     byte
+	column  byte
+	enabled bool
+
+	DataRecorder *DataRecorder
+}
+
+func NewFamilyBasicKeyboard(console *Console) *FamilyBasicKeyboard {
+	return &FamilyBasicKeyboard{
+		DataRecorder: NewDataRecorder(console),
+	}
+}
+
+// SetKeys sets the state of all keys (indexed by FamilyBasicKey).
+func (k *FamilyBasicKeyboard) SetKeys(keys [FamilyBasicKeyCount]bool) {
+	k.keys = keys
+}
+
+// SetKey presses or releases a single key.
+func (k *FamilyBasicKeyboard) SetKey(key FamilyBasicKey, pressed bool) {
+	if key >= 0 && key < FamilyBasicKeyCount {
+		k.keys[key] = pressed
+	}
+}
+
+func (k *FamilyBasicKeyboard) activeKeys(row, column byte) byte {
+	var value byte
+	base := int(row)*8 + int(column)*4
+	for i := 0; i < 4; i++ {
+		if k.keys[base+i] {
+			value |= 1 << i
+		}
+	}
+	return value
+}
+
+func (k *FamilyBasicKeyboard) Read(address uint16) byte {
+	switch address {
+	case 0x4016:
+		return k.DataRecorder.Read()
+	case 0x4017:
+		if !k.enabled {
+			return 0
+		}
+		if k.row < familyBasicKeyboardRows {
+			return (^k.activeKeys(k.row, k.column) << 1) & 0x1E
+		}
+		return 0x1E
+	}
+	return 0
+}
+
+func (k *FamilyBasicKeyboard) Write(value byte) {
+	k.DataRecorder.Write(value)
+
+	prevColumn := k.column
+	k.column = (value & 0x02) >> 1
+	k.enabled = (value & 0x04) == 0x04
+
+	if k.enabled {
+		if k.column == 0 && prevColumn == 1 {
+			// row 9 is read after the last row (all keys released)
+			k.row = (k.row + 1) % (familyBasicKeyboardRows + 1)
+		}
+		if (value & 0x01) == 0x01 {
+			k.row = 0
+		}
+	}
+}
+
+func (k *FamilyBasicKeyboard) UpdateFrame() {
+}
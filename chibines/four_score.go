@@ -0,0 +1,127 @@
+// refs: github.com/libretro/Mesen
+package chibines
+
+// 4-player adapters
+// https://www.nesdev.org/wiki/Four_player_adapters
+const (
+	// signatures are sent LSB first after the two controllers (reads 17-24)
+	fourScoreSignature4016 uint32 = 0x08 << 16 // %00010000 ($10)
+	fourScoreSignature4017 uint32 = 0x04 << 16 // %00100000 ($20)
+	horiSignature4016      uint32 = 0x04 << 16 // %00100000 ($20)
+	horiSignature4017      uint32 = 0x08 << 16 // %00010000 ($10)
+
+	// reads after the 24-bit report return 1
+	multitapReportEnd uint32 = 1 << 23
+)
+
+// FourScore is the NES Four Score. The same instance must be connected to
+// InputPort1 and InputPort2.
+// $4016 D0: player 1, player 3, signature $10
+// $4017 D0: player 2, player 4, signature $20
+type FourScore struct {
+	controllers [4]*Controller
+	strobe      byte
+	report      [2]uint32 // $4016, $4017
+}
+
+func NewFourScore(controller1, controller2, controller3, controller4 *Controller) *FourScore {
+	return &FourScore{
+		controllers: [4]*Controller{controller1, controller2, controller3, controller4},
+	}
+}
+
+func (f *FourScore) reload() {
+	f.report[0] = uint32(f.controllers[0].state()) | uint32(f.controllers[2].state())<<8 | fourScoreSignature4016
+	f.report[1] = uint32(f.controllers[1].state()) | uint32(f.controllers[3].state())<<8 | fourScoreSignature4017
+}
+
+func (f *FourScore) Read(address uint16) byte {
+	if f.strobe&1 == 1 {
+		f.reload()
+	}
+
+	i := address & 0x01
+	value := byte(f.report[i] & 0x01)
+	f.report[i] = (f.report[i] >> 1) | multitapReportEnd
+	return value
+}
+
+func (f *FourScore) Write(value byte) {
+	f.strobe = value
+	if f.strobe&1 == 1 {
+		f.reload()
+	}
+}
+
+func (f *FourScore) UpdateFrame() {
+}
+
+// FamicomFourPlayerAdapter connects players 3 and 4 to the Famicom
+// expansion port. Connect it to InputPortExpansion; players 1 and 2 stay
+// on the built-in controllers.
+// $4016 D1: player 3
+// $4017 D1: player 4
+// The Hori 4 Players Adapter (in 4-player mode) appends a 24-bit report
+// signature like the Four Score, with the signatures swapped.
+type FamicomFourPlayerAdapter struct {
+	controllers [2]*Controller
+	hori        bool
+	strobe      byte
+	report      [2]uint32 // $4016, $4017
+}
+
+func NewFamicomFourPlayerAdapter(controller3, controller4 *Controller, hori bool) *FamicomFourPlayerAdapter {
+	return &FamicomFourPlayerAdapter{
+		controllers: [2]*Controller{controller3, controller4},
+		hori:        hori,
+	}
+}
+
+func (f *FamicomFourPlayerAdapter) reload() {
+	f.report[0] = uint32(f.controllers[0].state())
+	f.report[1] = uint32(f.controllers[1].state())
+	if f.hori {
+		f.report[0] |= horiSignature4016
+		f.report[1] |= horiSignature4017
+	} else {
+		// simple adapter: 8 bits, then 1
+		f.report[0] |= 0xFFFF00
+		f.report[1] |= 0xFFFF00
+	}
+}
+
+func (f *FamicomFourPlayerAdapter) Read(address uint16) byte {
+	if f.strobe&1 == 1 {
+		f.reload()
+	}
+
+	i := address & 0x01
+	value := byte(f.report[i] & 0x01)
+	f.report[i] = (f.report[i] >> 1) | multitapReportEnd
+	return value << 1
+}
+
+func (f *FamicomFourPlayerAdapter) Write(value byte) {
+	f.strobe = value
+	if f.strobe&1 == 1 {
+		f.reload()
+	}
+}
+
+func (f *FamicomFourPlayerAdapter) UpdateFrame() {
+}
+
+// ConnectFourScore connects a Four Score to both controller ports.
+func (console *Console) ConnectFourScore() {
+	fourScore := NewFourScore(console.Controller1, console.Controller2, console.Controller3, console.Controller4)
+	console.SetInputDevice(InputPort1, fourScore)
+	console.SetInputDevice(InputPort2, fourScore)
+}
+
+// ConnectFamicomFourPlayerAdapter connects a 4-player adapter to the
+// expansion port (hori: Hori 4 Players Adapter with signature).
+func (console *Console) ConnectFamicomFourPlayerAdapter(hori bool) {
+	console.SetInputDevice(InputPort1, console.Controller1)
+	console.SetInputDevice(InputPort2, console.Controller2)
+	console.SetInputDevice(InputPortExpansion, NewFamicomFourPlayerAdapter(console.Controller3, console.Controller4, hori))
+}
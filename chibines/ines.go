@@ -2,10 +2,10 @@
 package chibines
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
-	"os"
 )
 
 const iNESFileMagic = 0x1a53454e
@@ -16,6 +16,9 @@ const PRG_BLOCK_SIZE = 16384
 // 8KiB (0x2000)
 const CHR_BLOCK_SIZE = 8192
 
+// 512B (0x200)
+const TRAINER_SIZE = 512
+
 type iNESFileHeader struct {
 	Magic    uint32  // iNES magic number
 	NumPRG   byte    // number of PRG-ROM banks (16KB each)
@@ -27,15 +30,22 @@ type iNESFileHeader struct {
 }
 
 // LoadNESFile reads an iNES file (.nes) and returns a Cartridge on success.
+// A patch file beside the ROM (.bps, .ups, .ips) is applied when present.
 // http://wiki.nesdev.com/w/index.php/INES
 // http://nesdev.com/NESDoc.pdf (page 28)
 func LoadNESFile(path string, console *Console) (*Cartridge, error) {
-	// open file
-	file, err := os.Open(path)
+	return LoadNESFileWithPatch(path, "", console)
+}
+
+// LoadNESFileWithPatch is like LoadNESFile, but applies the given patch file.
+// If patchPath is empty, it behaves like LoadNESFile.
+func LoadNESFileWithPatch(path string, patchPath string, console *Console) (*Cartridge, error) {
+	// read file (and apply patch)
+	data, err := ReadROMFile(path, patchPath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	file := bytes.NewReader(data)
 
 	// read file header
 	header := iNESFileHeader{}
@@ -61,9 +71,10 @@ func LoadNESFile(path string, console *Console) (*Cartridge, error) {
 	// battery-backed RAM
 	battery := (header.Control1 >> 1) & 1
 
-	// read trainer if present (unused)
+	// read trainer if present
+	var trainer []byte
 	if header.Control1&4 == 4 {
-		trainer := make([]byte, 512)
+		trainer = make([]byte, TRAINER_SIZE)
 		if _, err := io.ReadFull(file, trainer); err != nil {
 			return nil, err
 		}
@@ -92,6 +103,7 @@ func LoadNESFile(path string, console *Console) (*Cartridge, error) {
 		uint32(header.NumPRG)*PRG_BLOCK_SIZE,
 		uint32(header.NumCHR)*CHR_BLOCK_SIZE,
 	)
+	cartridge.Trainer = trainer
 	console.Cartridge = cartridge
 
 	mapper, err := NewMapper(console)
@@ -0,0 +1,87 @@
+// ORIGINAL
+package chibines
+
+// Input ports
+// https://www.nesdev.org/wiki/Input_devices
+// https://www.nesdev.org/wiki/Expansion_port
+const (
+	InputPort1         = 1 // $4016 (NES port 1 / Famicom controller I)
+	InputPort2         = 2 // $4017 (NES port 2 / Famicom controller II)
+	InputPortExpansion = 3 // $4016 and $4017 (Famicom expansion port)
+)
+
+// InputDevice is a device connected to a controller port or to the Famicom
+// expansion port.
+type InputDevice interface {
+	// Write receives every value written to $4016 (strobe, OUT0-OUT2).
+	Write(value byte)
+	// Read returns the data lines D0-D4 for a read of $4016 or $4017.
+	// Devices on a controller port are only read through their own address.
+	Read(address uint16) byte
+	// UpdateFrame is called once per frame (at the start of vblank).
+	UpdateFrame()
+}
+
+// readInputPort combines the data lines of the port device and the
+// expansion port device.
+func (b *Bus) readInputPort(address uint16) byte {
+	var value byte
+
+	device := b.Port1
+	if address == 0x4017 {
+		device = b.Port2
+	}
+	if device != nil {
+		value |= device.Read(address) & 0x1F
+	}
+	if b.ExpansionPort != nil {
+		value |= b.ExpansionPort.Read(address) & 0x1F
+	}
+
+	// XXX: open bus (upper bits of the address)
+	return value | 0x40
+}
+
+func (b *Bus) writeInputPort(value byte) {
+	for _, device := range []InputDevice{b.Port1, b.Port2, b.ExpansionPort} {
+		if device != nil {
+			device.Write(value)
+		}
+	}
+}
+
+func (b *Bus) updateInputDevices() {
+	for _, device := range []InputDevice{b.Port1, b.Port2, b.ExpansionPort} {
+		if device != nil {
+			device.UpdateFrame()
+		}
+	}
+}
+
+// SetInputDevice connects a device to InputPort1, InputPort2 or
+// InputPortExpansion. A nil device disconnects the port.
+func (console *Console) SetInputDevice(port int, device InputDevice) {
+	bus := console.CPU.bus
+	switch port {
+	case InputPort1:
+		bus.Port1 = device
+	case InputPort2:
+		bus.Port2 = device
+	case InputPortExpansion:
+		bus.ExpansionPort = device
+	}
+}
+
+// InputDevice returns the device connected to the port (nil if none).
+func (console *Console) InputDevice(port int) InputDevice {
+	bus := console.CPU.bus
+	switch port {
+	case InputPort1:
+		return bus.Port1
+	case InputPort2:
+		return bus.Port2
+	case InputPortExpansion:
+		return bus.ExpansionPort
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// ORIGINAL
+
+// Package input is the input layer between a frontend and chibines.Console.
+// It adds turbo buttons and recordable input macros to the button states
+// read from the keyboard or a gamepad, and can be used by any frontend
+// (GUI or headless).
+//
+//	layer := input.NewLayer()
+//	for each frame {
+//		states := [input.MaxPlayers]input.State{...}
+//		layer.ApplyTo(console, states)
+//		console.StepFrame()
+//	}
+package input
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+// MaxPlayers is the number of players handled by the layer
+// (SetButtons1 - SetButtons4).
+const MaxPlayers = 4
+
+const (
+	DefaultTurboOnFrames  = 2
+	DefaultTurboOffFrames = 2
+)
+
+// State is the input of one player for one frame.
+type State struct {
+	Buttons [8]bool // indexed by chibines.ButtonA ... chibines.ButtonRight
+	TurboA  bool
+	TurboB  bool
+}
+
+type macroPlayback struct {
+	macro  *Macro
+	player int
+	frame  int
+}
+
+// Layer turns the raw State of each player into the buttons sent to the
+// console. Apply must be called once per frame.
+type Layer struct {
+	turboOnFrames  int
+	turboOffFrames int
+	frame          uint64
+
+	macros    map[string]*Macro
+	playbacks []*macroPlayback
+
+	recording       *Macro
+	recordingPlayer int
+}
+
+func NewLayer() *Layer {
+	return &Layer{
+		turboOnFrames:  DefaultTurboOnFrames,
+		turboOffFrames: DefaultTurboOffFrames,
+		macros:         make(map[string]*Macro),
+	}
+}
+
+// SetTurboRate sets how many frames turbo buttons are pressed and released.
+func (l *Layer) SetTurboRate(onFrames, offFrames int) {
+	if onFrames < 1 {
+		onFrames = 1
+	}
+	if offFrames < 1 {
+		offFrames = 1
+	}
+	l.turboOnFrames = onFrames
+	l.turboOffFrames = offFrames
+}
+
+func (l *Layer) TurboRate() (int, int) {
+	return l.turboOnFrames, l.turboOffFrames
+}
+
+func (l *Layer) turboPressed() bool {
+	period := uint64(l.turboOnFrames + l.turboOffFrames)
+	return l.frame%period < uint64(l.turboOnFrames)
+}
+
+// Apply returns the buttons of each player for the current frame and
+// advances the layer by one frame.
+func (l *Layer) Apply(states [MaxPlayers]State) [MaxPlayers][8]bool {
+	var result [MaxPlayers][8]bool
+
+	turbo := l.turboPressed()
+	for i, state := range states {
+		result[i] = state.Buttons
+		if state.TurboA && turbo {
+			result[i][chibines.ButtonA] = true
+		}
+		if state.TurboB && turbo {
+			result[i][chibines.ButtonB] = true
+		}
+	}
+
+	// record before injecting macros, so a macro never records itself
+	if l.recording != nil {
+		l.recording.Frames = append(l.recording.Frames, result[l.recordingPlayer])
+	}
+
+	playbacks := l.playbacks[:0]
+	for _, p := range l.playbacks {
+		buttons := p.macro.Frames[p.frame]
+		for b := range buttons {
+			result[p.player][b] = result[p.player][b] || buttons[b]
+		}
+		p.frame++
+		if p.frame < len(p.macro.Frames) {
+			playbacks = append(playbacks, p)
+		}
+	}
+	l.playbacks = playbacks
+
+	l.frame++
+	return result
+}
+
+// ApplyTo is Apply followed by SetButtons1 - SetButtons4.
+func (l *Layer) ApplyTo(console *chibines.Console, states [MaxPlayers]State) {
+	result := l.Apply(states)
+	console.SetButtons1(result[0])
+	console.SetButtons2(result[1])
+	console.SetButtons3(result[2])
+	console.SetButtons4(result[3])
+}
+
+// StartRecording starts recording the buttons of player (0-3) into a
+// macro. A macro with the same name is replaced when recording stops.
+func (l *Layer) StartRecording(name string, player int) error {
+	if player < 0 || player >= MaxPlayers {
+		return fmt.Errorf("invalid player: %d", player)
+	}
+	l.recording = &Macro{Name: name}
+	l.recordingPlayer = player
+	return nil
+}
+
+func (l *Layer) IsRecording() bool {
+	return l.recording != nil
+}
+
+// StopRecording stops recording and stores the macro. It returns nil if
+// nothing was recorded.
+func (l *Layer) StopRecording() *Macro {
+	macro := l.recording
+	l.recording = nil
+	if macro == nil || len(macro.Frames) == 0 {
+		return nil
+	}
+	l.macros[macro.Name] = macro
+	return macro
+}
+
+// PlayMacro injects a macro into the buttons of player (0-3), starting
+// with the next frame. Macro buttons are combined with the live buttons.
+func (l *Layer) PlayMacro(name string, player int) error {
+	if player < 0 || player >= MaxPlayers {
+		return fmt.Errorf("invalid player: %d", player)
+	}
+	macro, ok := l.macros[name]
+	if !ok {
+		return fmt.Errorf("macro not found: %s", name)
+	}
+	if len(macro.Frames) == 0 {
+		return errors.New("macro is empty")
+	}
+	l.playbacks = append(l.playbacks, &macroPlayback{macro: macro, player: player})
+	return nil
+}
+
+// StopMacros cancels all macros being played.
+func (l *Layer) StopMacros() {
+	l.playbacks = nil
+}
+
+func (l *Layer) Macro(name string) *Macro {
+	return l.macros[name]
+}
+
+func (l *Layer) AddMacro(macro *Macro) {
+	l.macros[macro.Name] = macro
+}
+
+func (l *Layer) RemoveMacro(name string) {
+	delete(l.macros, name)
+}
+
+// Macros returns all stored macros.
+func (l *Layer) Macros() []*Macro {
+	macros := make([]*Macro, 0, len(l.macros))
+	for _, macro := range l.macros {
+		macros = append(macros, macro)
+	}
+	return macros
+}
@@ -0,0 +1,96 @@
+// ORIGINAL
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Macro is a named sequence of per-frame button states.
+type Macro struct {
+	Name   string
+	Frames [][8]bool
+}
+
+// Button letters used in macro files, in chibines.ButtonA ... ButtonRight order.
+// A frame is written as 8 characters, '.' for released buttons (e.g. "A..S.D..").
+const macroButtonLetters = "ABsSUDLR"
+
+type macroJSON struct {
+	Name   string   `json:"name"`
+	Frames []string `json:"frames"`
+}
+
+func (m *Macro) MarshalJSON() ([]byte, error) {
+	v := macroJSON{
+		Name:   m.Name,
+		Frames: make([]string, len(m.Frames)),
+	}
+	for i, buttons := range m.Frames {
+		frame := []byte("........")
+		for b, pressed := range buttons {
+			if pressed {
+				frame[b] = macroButtonLetters[b]
+			}
+		}
+		v.Frames[i] = string(frame)
+	}
+	return json.Marshal(v)
+}
+
+func (m *Macro) UnmarshalJSON(data []byte) error {
+	var v macroJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	m.Name = v.Name
+	m.Frames = make([][8]bool, len(v.Frames))
+	for i, frame := range v.Frames {
+		if len(frame) != len(macroButtonLetters) {
+			return fmt.Errorf("macro %s: invalid frame %d: %q", v.Name, i, frame)
+		}
+		for b := range m.Frames[i] {
+			m.Frames[i][b] = frame[b] != '.'
+		}
+	}
+	return nil
+}
+
+// LoadMacros adds the macros stored in a JSON file.
+func (l *Layer) LoadMacros(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var macros []*Macro
+	if err := json.Unmarshal(data, &macros); err != nil {
+		return err
+	}
+	for i, macro := range macros {
+		if macro == nil || macro.Name == "" {
+			return fmt.Errorf("%s: macro %d has no name", path, i)
+		}
+	}
+	for _, macro := range macros {
+		l.AddMacro(macro)
+	}
+	return nil
+}
+
+// SaveMacros writes all macros to a JSON file.
+func (l *Layer) SaveMacros(path string) error {
+	macros := l.Macros()
+	sort.Slice(macros, func(i, j int) bool {
+		return macros[i].Name < macros[j].Name
+	})
+
+	data, err := json.MarshalIndent(macros, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
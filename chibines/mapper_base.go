@@ -131,7 +131,9 @@ func NewMapperBase(cartridge *Cartridge) *MapperBase {
 		m.workRAMPageSize = 0x2000
 	}
 
-	// XX: Impl trainer
+	if cartridge.HasTrainer() {
+		m.LoadTrainer()
+	}
 
 	switch cartridge.Mirror {
 	case 0:
@@ -143,6 +145,26 @@ func NewMapperBase(cartridge *Cartridge) *MapperBase {
 	return m
 }
 
+// LoadTrainer copies the trainer into PRG-RAM at $7000-$71FF and maps
+// $6000-$7FFF to PRG-RAM. Mappers that bank PRG-RAM by themselves override
+// this mapping afterwards; the trainer stays in the RAM.
+func (m *MapperBase) LoadTrainer() {
+	ram := m.workRAM
+	memoryType := PRG_MEMORY_WORK_RAM
+	if m.cartridge.HasBattery() {
+		ram = m.saveRAM
+		memoryType = PRG_MEMORY_SAVE_RAM
+	}
+
+	// XXX: Magic Number ($7000 - $6000)
+	if len(ram) < 0x1000+TRAINER_SIZE {
+		return
+	}
+	copy(ram[0x1000:], m.cartridge.Trainer)
+
+	m.SetCPUMemoryMappingByPageNumber(0x6000, 0x7FFF, 0, memoryType, MEMORY_ACCESS_UNSPECIFIED)
+}
+
 func (m *MapperBase) SetCPUMemoryMappingBySourceMemory(startAddr uint16, endAddr uint16, source []byte, accessType MemoryAccessType) {
 	startAddr >>= 8
 	endAddr >>= 8
@@ -0,0 +1,279 @@
+// ORIGINAL
+
+// Package midi transcribes the square, triangle and noise channels of the
+// APU to a Standard MIDI File, one track per channel:
+//
+//	t := midi.NewTranscriber()
+//	for each frame {
+//		player.StepCycles(...) // or console.StepFrame()
+//		t.Sample(console.APU)
+//	}
+//	err := t.Save("music.mid")
+//
+// A note starts when a channel becomes audible or its pitch moves by a
+// semitone or more, with the velocity of its volume. Smaller pitch changes
+// (vibrato, slides) are written as pitch bends. The noise is written to the
+// General MIDI drum channel, with a drum chosen by its period.
+//
+// https://www.midi.org/specifications-old/item/standard-midi-files-smf
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+const (
+	division = 480    // ticks per quarter note
+	tempo    = 500000 // microseconds per quarter note (120 BPM)
+
+	bendCenter = 0x2000
+	bendRange  = 2   // semitones (the General MIDI default)
+	bendDead   = 0.1 // semitones: smaller offsets (tuning) are ignored
+
+	drumChannel = 9
+)
+
+// General MIDI programs (0-based) of the square duty cycles: 50% sounds like
+// "Lead 1 (square)", the thinner ones like "Lead 2 (sawtooth)".
+var dutyPrograms = [4]byte{81, 81, 80, 81}
+
+const triangleProgram = 73 // Flute
+
+var channels = []struct {
+	channel     chibines.APUChannel
+	midiChannel byte
+}{
+	{chibines.ChannelSquare1, 0},
+	{chibines.ChannelSquare2, 1},
+	{chibines.ChannelTriangle, 2},
+	{chibines.ChannelNoise, drumChannel},
+}
+
+type track struct {
+	channel     chibines.APUChannel
+	midiChannel byte
+	events      bytes.Buffer
+	lastTick    int
+
+	note    int // playing note, -1 for none
+	bend    int
+	program int
+	volume  byte
+	period  byte
+}
+
+// Transcriber collects the states of the channels, one sample per frame.
+type Transcriber struct {
+	title  string
+	tracks []*track
+	frame  int
+}
+
+func NewTranscriber() *Transcriber {
+	t := &Transcriber{}
+	for _, c := range channels {
+		tr := &track{
+			channel:     c.channel,
+			midiChannel: c.midiChannel,
+			note:        -1,
+			bend:        bendCenter,
+			program:     -1,
+		}
+		tr.meta(0, 0x03, []byte(c.channel.String()))
+		t.tracks = append(t.tracks, tr)
+	}
+	return t
+}
+
+// SetTitle sets the name of the sequence (e.g. the NSF song name).
+func (t *Transcriber) SetTitle(title string) {
+	t.title = title
+}
+
+// frameTick returns the time of a frame in ticks.
+func frameTick(frame int) int {
+	return int(math.Round(float64(frame) * division * 1000000 / tempo / chibines.FrameRate))
+}
+
+// Sample reads the state of the channels. Call it once per frame.
+func (t *Transcriber) Sample(apu *chibines.APU) {
+	tick := frameTick(t.frame)
+	for _, tr := range t.tracks {
+		state := apu.ChannelState(tr.channel)
+		if tr.channel == chibines.ChannelNoise {
+			tr.sampleNoise(tick, state)
+		} else {
+			tr.samplePitched(tick, state)
+		}
+	}
+	t.frame++
+}
+
+// midiNote returns the (fractional) MIDI note of a frequency.
+func midiNote(frequency float32) float64 {
+	return 69 + 12*math.Log2(float64(frequency)/440)
+}
+
+func velocity(volume byte) byte {
+	return 1 + volume*126/15
+}
+
+func (tr *track) samplePitched(tick int, state chibines.APUChannelState) {
+	note := midiNote(state.Frequency)
+	if !state.Playing || state.Volume == 0 || state.Frequency == 0 || note < 0 || note > 127 {
+		tr.noteOff(tick)
+		return
+	}
+
+	if tr.note >= 0 && math.Abs(note-float64(tr.note)) >= 1 {
+		tr.noteOff(tick)
+	}
+	if tr.note < 0 {
+		program := triangleProgram
+		if tr.channel != chibines.ChannelTriangle {
+			program = int(dutyPrograms[state.Duty&3])
+		}
+		if program != tr.program {
+			tr.program = program
+			tr.event(tick, 0xC0|tr.midiChannel, byte(program))
+		}
+		start := int(math.Round(note))
+		tr.setBend(tick, note-float64(start))
+		tr.noteOn(tick, start, velocity(state.Volume))
+		return
+	}
+	tr.setBend(tick, note-float64(tr.note))
+}
+
+// drumNote returns the General MIDI drum of a noise period: hi-hats for the
+// short periods, snare and bass drums for the long ones.
+func drumNote(period byte, shortMode bool) int {
+	switch {
+	case shortMode:
+		return 56 // Cowbell
+	case period < 4:
+		return 42 // Closed Hi-Hat
+	case period < 8:
+		return 46 // Open Hi-Hat
+	case period < 12:
+		return 38 // Acoustic Snare
+	}
+	return 36 // Bass Drum 1
+}
+
+func (tr *track) sampleNoise(tick int, state chibines.APUChannelState) {
+	if !state.Playing || state.Volume == 0 {
+		tr.noteOff(tick)
+		tr.volume = 0
+		return
+	}
+
+	// a new hit: the drum changes, or the volume rises (envelope restart)
+	note := drumNote(state.Period, state.ShortMode)
+	if tr.note != note || state.Volume > tr.volume {
+		tr.noteOff(tick)
+		tr.noteOn(tick, note, velocity(state.Volume))
+	}
+	tr.volume = state.Volume
+}
+
+func (tr *track) noteOn(tick int, note int, velocity byte) {
+	tr.note = note
+	tr.event(tick, 0x90|tr.midiChannel, byte(note), velocity)
+}
+
+func (tr *track) noteOff(tick int) {
+	if tr.note < 0 {
+		return
+	}
+	tr.event(tick, 0x80|tr.midiChannel, byte(tr.note), 0)
+	tr.note = -1
+}
+
+// setBend bends the note by offset semitones.
+func (tr *track) setBend(tick int, offset float64) {
+	if math.Abs(offset) < bendDead {
+		offset = 0
+	}
+	bend := bendCenter + int(math.Round(offset/bendRange*bendCenter))
+	if bend < 0 {
+		bend = 0
+	} else if bend > 0x3FFF {
+		bend = 0x3FFF
+	}
+	if bend == tr.bend {
+		return
+	}
+	tr.bend = bend
+	tr.event(tick, 0xE0|tr.midiChannel, byte(bend&0x7F), byte(bend>>7))
+}
+
+// event appends an event at tick.
+func (tr *track) event(tick int, data ...byte) {
+	writeVarLen(&tr.events, uint32(tick-tr.lastTick))
+	tr.events.Write(data)
+	tr.lastTick = tick
+}
+
+// meta appends a meta event at tick.
+func (tr *track) meta(tick int, metaType byte, data []byte) {
+	tr.event(tick, 0xFF, metaType)
+	writeVarLen(&tr.events, uint32(len(data)))
+	tr.events.Write(data)
+}
+
+func writeVarLen(buf *bytes.Buffer, value uint32) {
+	var b [5]byte
+	i := len(b) - 1
+	b[i] = byte(value & 0x7F)
+	for value >>= 7; value > 0; value >>= 7 {
+		i--
+		b[i] = byte(value&0x7F) | 0x80
+	}
+	buf.Write(b[i:])
+}
+
+// Bytes returns the Standard MIDI File (format 1): a tempo track and one
+// track per channel. The playing notes end at the last sample.
+func (t *Transcriber) Bytes() []byte {
+	end := frameTick(t.frame)
+
+	conductor := &track{}
+	if t.title != "" {
+		conductor.meta(0, 0x03, []byte(t.title))
+	}
+	conductor.meta(0, 0x51, []byte{tempo >> 16 & 0xFF, tempo >> 8 & 0xFF, tempo & 0xFF})
+	conductor.meta(end, 0x2F, nil)
+
+	out := &bytes.Buffer{}
+	out.WriteString("MThd")
+	binary.Write(out, binary.BigEndian, []uint32{6})
+	binary.Write(out, binary.BigEndian, []uint16{1, uint16(1 + len(t.tracks)), division})
+
+	tracks := [][]byte{conductor.events.Bytes()}
+	for _, tr := range t.tracks {
+		// the end of the track is added to a copy, so sampling can go on
+		tail := &track{midiChannel: tr.midiChannel, lastTick: tr.lastTick, note: tr.note}
+		tail.noteOff(end)
+		tail.meta(end, 0x2F, nil)
+		events := append(append([]byte{}, tr.events.Bytes()...), tail.events.Bytes()...)
+		tracks = append(tracks, events)
+	}
+
+	for _, events := range tracks {
+		out.WriteString("MTrk")
+		binary.Write(out, binary.BigEndian, uint32(len(events)))
+		out.Write(events)
+	}
+	return out.Bytes()
+}
+
+// Save writes the Standard MIDI File to path.
+func (t *Transcriber) Save(path string) error {
+	return os.WriteFile(path, t.Bytes(), 0644)
+}
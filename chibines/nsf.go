@@ -1,8 +1,10 @@
 package chibines
 
 import (
+	"bytes"
 	"encoding/binary"
 	"os"
+	"time"
 )
 
 type NSFFileHeader struct {
@@ -34,24 +36,35 @@ type NSFFileInfo struct {
 	*NSFFileHeader
 
 	ROM []byte
+
+	// Tracks has the name, length and fade of each song (from NSFe files).
+	Tracks []NSFTrackInfo
+	// Playlist is the order of the songs of an NSFe file (nil: all the songs
+	// in order).
+	Playlist []byte
+}
+
+// NSFUnknownLength is the length or fade of a track without metadata.
+const NSFUnknownLength time.Duration = -1
+
+type NSFTrackInfo struct {
+	Name   string
+	Length time.Duration // before the fade
+	Fade   time.Duration
 }
 
 func ParseNSFFileInfo(path string) (*NSFFileInfo, error) {
-	// open file
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	stat, err := file.Stat()
-	if err != nil {
-		return nil, err
+	if bytes.HasPrefix(data, []byte(nsfeSignature)) {
+		return parseNSFeFileInfo(data)
 	}
 
 	// read file header
 	header := NSFFileHeader{}
-	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
 		return nil, err
 	}
 
@@ -61,13 +74,17 @@ func ParseNSFFileInfo(path string) (*NSFFileInfo, error) {
 	// fmt.Printf("Copyright: %s\n", header.CopyrightHolder)
 	// fmt.Printf("BankSetup: %v\n", header.BankSetup)
 
-	data := make([]byte, stat.Size()-0x80)
-	if err := binary.Read(file, binary.LittleEndian, data); err != nil {
-		return nil, err
-	}
+	return newNSFFileInfo(&header, data[0x80:]), nil
+}
 
+func newNSFFileInfo(header *NSFFileHeader, data []byte) *NSFFileInfo {
 	nsfFileInfo := &NSFFileInfo{
-		NSFFileHeader: &header,
+		NSFFileHeader: header,
+		Tracks:        make([]NSFTrackInfo, header.TotalSongs),
+	}
+	for i := range nsfFileInfo.Tracks {
+		nsfFileInfo.Tracks[i].Length = NSFUnknownLength
+		nsfFileInfo.Tracks[i].Fade = NSFUnknownLength
 	}
 
 	if nsfFileInfo.usesBanks() {
@@ -80,7 +97,7 @@ func ParseNSFFileInfo(path string) (*NSFFileInfo, error) {
 		nsfFileInfo.ROM = rom
 	}
 
-	return nsfFileInfo, nil
+	return nsfFileInfo
 }
 
 func LoadNSFFile(path string, console *Console) (*Cartridge, error) {
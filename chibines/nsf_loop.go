@@ -0,0 +1,73 @@
+// ORIGINAL
+package chibines
+
+// loopDetector finds the loop of a song from the APU register writes of each
+// play call (frame): when the writes of the last window frames are the same
+// as the writes of an earlier window, the song has looped.
+type loopDetector struct {
+	window  int
+	frames  []uint64       // hash of the register writes of each frame
+	windows map[uint64]int // rolling hash of a window -> first frame after it
+	hash    uint64         // rolling hash of the last window frames
+	power   uint64         // loopHashBase^window
+	active  int            // frames with register writes in the last window
+}
+
+const loopHashBase = 1000003
+
+func newLoopDetector(window int) *loopDetector {
+	if window < 1 {
+		window = 1
+	}
+	d := &loopDetector{
+		window:  window,
+		windows: map[uint64]int{},
+		power:   1,
+	}
+	for i := 0; i < window; i++ {
+		d.power *= loopHashBase
+	}
+	return d
+}
+
+// addFrame adds the hash of the register writes of a frame, and returns the
+// length of the loop in frames once it is found (else 0). Windows without
+// register writes (silence) never match, and a loop is at least a window
+// long.
+func (d *loopDetector) addFrame(frame uint64) int {
+	d.frames = append(d.frames, frame)
+	n := len(d.frames)
+	d.hash = d.hash*loopHashBase + frame
+	if frame != fnvOffset64 {
+		d.active++
+	}
+	if n > d.window {
+		old := d.frames[n-1-d.window]
+		d.hash -= old * d.power
+		if old != fnvOffset64 {
+			d.active--
+		}
+	}
+	if n < d.window || d.active == 0 {
+		return 0
+	}
+
+	end, found := d.windows[d.hash]
+	if !found {
+		d.windows[d.hash] = n
+		return 0
+	}
+	if n-end >= d.window && d.sameWindows(end, n) {
+		return n - end
+	}
+	return 0
+}
+
+func (d *loopDetector) sameWindows(end1 int, end2 int) bool {
+	for i := 1; i <= d.window; i++ {
+		if d.frames[end1-i] != d.frames[end2-i] {
+			return false
+		}
+	}
+	return true
+}
@@ -16,8 +16,32 @@ type NSFPlayer struct {
 	NSFFileInfo *NSFFileInfo
 
 	PlayState bool
+
+	// The songs without a length (see SetSongLength) play for DefaultSongLen
+	// (0 = forever), or until they have looped LoopCount times (0 = no loop
+	// detection), then fade out for DefaultSongFadeLen. A song which is
+	// silent for SilenceLen (0 = never) ends without fade.
+	DefaultSongLen     time.Duration
+	DefaultSongFadeLen time.Duration
+	LoopCount          int
+	SilenceLen         time.Duration
+
+	playCycles float64 // CPU cycles until the next play call (StepCycles)
+	songCycles uint64  // CPU cycles since the start of the song
+	lastSound  time.Duration
+	loops      *loopDetector // nil when the length is known
+	ended      bool
 }
 
+const (
+	// the loop detector compares windows of this length
+	loopWindow = 8 * time.Second
+	// songs whose loop is not found in this time play for DefaultSongLen
+	maxLoopSearch = 20 * time.Minute
+	// below this peak level the output is silent (about -60dB)
+	silenceLevel = 0.001
+)
+
 func NewNSFPlayer(path string) (*NSFPlayer, error) {
 	console, err := NewConsole(path, true)
 	if err != nil {
@@ -77,7 +101,20 @@ func (np *NSFPlayer) initNSFtune(songNum byte) {
 	}
 
 	np.CurrentSong = songNum
-	np.CurrentSongLen = 0
+	np.playCycles = 0
+	np.songCycles = 0
+	np.lastSound = 0
+	np.ended = false
+	apu := np.Console.APU
+	apu.fadeGain = 1
+	apu.peak = 0
+	apu.resetWriteHash()
+	if int(songNum) < len(np.NSFFileInfo.Tracks) {
+		track := np.NSFFileInfo.Tracks[songNum]
+		np.SetSongLength(track.Length, track.Fade)
+	} else {
+		np.SetSongLength(NSFUnknownLength, NSFUnknownLength)
+	}
 
 	np.CurrentSongStart = time.Now()
 	np.LastPlayCall = time.Now()
@@ -94,21 +131,134 @@ func (np *NSFPlayer) StepSeconds(seconds float64) {
 			timeLeft := np.PlayCallInterval - now.Sub(np.LastPlayCall).Seconds()
 			if timeLeft <= 0 {
 				np.LastPlayCall = now
+				np.updateSong()
 				np.Console.CPU.state.SP = 0xFD
 				np.Console.CPU.push16(0x0000)
 				np.Console.CPU.state.PC = np.NSFFileInfo.PlayAddress
 			}
 		}
 
+		stepped := 1
 		if np.Console.CPU.state.PC != 0x0001 {
-			cycles -= np.Console.Step()
+			stepped = np.Console.Step()
 		} else {
 			np.Console.CPU.StartCPUCycle(true)
 			np.Console.CPU.EndCPUCycle(true)
+		}
+		cycles -= stepped
+		np.songCycles += uint64(stepped)
+	}
+}
+
+// StepCycles runs the player for cycles CPU cycles. Unlike StepSeconds, the
+// play routine is called every PlayCallInterval of emulated time instead of
+// real time, so the output is the same whatever the speed (e.g. to render
+// faster than real time).
+func (np *NSFPlayer) StepCycles(cycles int) {
+	for cycles > 0 {
+		if np.Console.CPU.state.PC == 0x0001 && np.playCycles <= 0 {
+			np.playCycles += np.PlayCallInterval * CPUFrequency
+			np.updateSong()
+			np.Console.CPU.state.SP = 0xFD
+			np.Console.CPU.push16(0x0000)
+			np.Console.CPU.state.PC = np.NSFFileInfo.PlayAddress
+		}
+
+		stepped := 1
+		if np.Console.CPU.state.PC != 0x0001 {
+			stepped = np.Console.Step()
+		} else {
+			np.Console.CPU.StartCPUCycle(true)
+			np.Console.CPU.EndCPUCycle(true)
+		}
+		cycles -= stepped
+		np.playCycles -= float64(stepped)
+		np.songCycles += uint64(stepped)
+	}
+}
+
+// SetSongLength sets the length (before the fade) and the fade of the
+// current song. With NSFUnknownLength, the length is found by the loop
+// detection or DefaultSongLen, and the fade is DefaultSongFadeLen.
+func (np *NSFPlayer) SetSongLength(length time.Duration, fade time.Duration) {
+	np.loops = nil
+	if length < 0 {
+		length = np.DefaultSongLen
+		if np.LoopCount > 0 {
+			np.loops = newLoopDetector(int(loopWindow.Seconds() / np.PlayCallInterval))
+		}
+	}
+	if fade < 0 {
+		fade = np.DefaultSongFadeLen
+	}
+	np.CurrentSongLen = length
+	np.CurrentSongFadeLen = fade
+}
 
-			cycles -= 1
+// Elapsed returns the time played since the start of the song (emulated
+// time).
+func (np *NSFPlayer) Elapsed() time.Duration {
+	return time.Duration(float64(np.songCycles) / CPUFrequency * float64(time.Second))
+}
+
+// Ended reports whether the current song has ended: faded out after its
+// length, or silent for SilenceLen. The player keeps running (silent): the
+// frontend moves to the next song.
+func (np *NSFPlayer) Ended() bool {
+	return np.ended
+}
+
+// updateSong detects the loop, the silence and the end of the song, and
+// fades out the output. It is called before each play call.
+func (np *NSFPlayer) updateSong() {
+	apu := np.Console.APU
+	elapsed := np.Elapsed()
+
+	if np.loops != nil {
+		if loop := np.loops.addFrame(apu.writeHash); loop > 0 {
+			// the loop has been played once, and its last window twice
+			frame := time.Duration(np.PlayCallInterval * float64(time.Second))
+			length := elapsed - frame*time.Duration(np.loops.window) + frame*time.Duration(loop*(np.LoopCount-1))
+			if length < elapsed {
+				length = elapsed
+			}
+			if np.CurrentSongLen == 0 || length < np.CurrentSongLen {
+				np.CurrentSongLen = length
+			}
+			np.loops = nil
+		} else if elapsed > maxLoopSearch {
+			np.loops = nil
 		}
 	}
+	apu.resetWriteHash()
+
+	if np.SilenceLen > 0 && apu.sampleRate != 0 {
+		if apu.peak > silenceLevel {
+			np.lastSound = elapsed
+		}
+		apu.peak = 0
+		if elapsed-np.lastSound >= np.SilenceLen {
+			np.ended = true
+		}
+	}
+
+	if np.CurrentSongLen > 0 && elapsed >= np.CurrentSongLen {
+		fade := elapsed - np.CurrentSongLen
+		if fade >= np.CurrentSongFadeLen {
+			apu.fadeGain = 0
+			np.ended = true
+		} else {
+			apu.fadeGain = 1 - float32(fade)/float32(np.CurrentSongFadeLen)
+		}
+	}
+}
+
+// SetSong starts a song (0 = first song).
+func (np *NSFPlayer) SetSong(songNum byte) {
+	if songNum >= np.NSFFileInfo.TotalSongs {
+		return
+	}
+	np.initNSFtune(songNum)
 }
 
 func (np *NSFPlayer) PrevSong() {
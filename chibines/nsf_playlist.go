@@ -0,0 +1,233 @@
+// ORIGINAL
+package chibines
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NSFPlaylistEntry is a song of a playlist. Length and Fade are
+// NSFUnknownLength when the playlist doesn't give them.
+type NSFPlaylistEntry struct {
+	Path   string
+	Song   byte // 0 = first song
+	Title  string
+	Length time.Duration // before the fade
+	Fade   time.Duration
+}
+
+// NSFPlaylist is a list of songs, possibly from several NSF files.
+type NSFPlaylist struct {
+	Entries []NSFPlaylistEntry
+	Current int
+}
+
+// NewNSFPlaylist returns the songs of an NSF file, in the order of its NSFe
+// playlist if any, starting at its starting song.
+func NewNSFPlaylist(path string, info *NSFFileInfo) *NSFPlaylist {
+	playlist := &NSFPlaylist{Entries: nsfFileEntries(path, info)}
+	for i, entry := range playlist.Entries {
+		if entry.Song == info.StartingSong-1 {
+			playlist.Current = i
+			break
+		}
+	}
+	return playlist
+}
+
+func nsfFileEntries(path string, info *NSFFileInfo) []NSFPlaylistEntry {
+	songs := info.Playlist
+	if songs == nil {
+		for song := byte(0); song < info.TotalSongs; song++ {
+			songs = append(songs, song)
+		}
+	}
+
+	entries := make([]NSFPlaylistEntry, len(songs))
+	for i, song := range songs {
+		track := info.Tracks[song]
+		entries[i] = NSFPlaylistEntry{
+			Path:   path,
+			Song:   song,
+			Title:  track.Name,
+			Length: track.Length,
+			Fade:   track.Fade,
+		}
+	}
+	return entries
+}
+
+// LoadNSFPlaylist loads an .m3u playlist. Each line is the path of an NSF
+// file (all its songs), or a song in the extended NEZplug format:
+//
+//	file.nsf::NSF,track,title,length,loop,fade,loopcount
+//
+// The track is 1 for the first song ($00 in hexadecimal), the times are
+// [[h:]m:]s[.ms]. The length is the time of the intro and one loop; with a
+// loop length and a loop count, the loop is played loopcount times. Commas
+// in the title are escaped as "\,". The paths are relative to the playlist.
+func LoadNSFPlaylist(path string) (*NSFPlaylist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	playlist := &NSFPlaylist{}
+	dir := filepath.Dir(path)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		name, fields, extended := strings.Cut(line, "::")
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		if !extended {
+			info, err := ParseNSFFileInfo(name)
+			if err != nil {
+				return nil, err
+			}
+			playlist.Entries = append(playlist.Entries, nsfFileEntries(name, info)...)
+			continue
+		}
+
+		entry, err := parseNEZplugEntry(name, fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filepath.Base(path), lineNum, err)
+		}
+		playlist.Entries = append(playlist.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(playlist.Entries) == 0 {
+		return nil, fmt.Errorf("%s: empty playlist", filepath.Base(path))
+	}
+	return playlist, nil
+}
+
+func parseNEZplugEntry(path string, line string) (NSFPlaylistEntry, error) {
+	entry := NSFPlaylistEntry{
+		Path:   path,
+		Length: NSFUnknownLength,
+		Fade:   NSFUnknownLength,
+	}
+
+	fields := splitNEZplugFields(line)
+	for len(fields) < 7 {
+		fields = append(fields, "")
+	}
+	if !strings.EqualFold(fields[0], "NSF") {
+		return entry, fmt.Errorf("unsupported type: %s", fields[0])
+	}
+
+	track := fields[1]
+	var song uint64
+	var err error
+	if strings.HasPrefix(track, "$") {
+		song, err = strconv.ParseUint(track[1:], 16, 8)
+	} else {
+		song, err = strconv.ParseUint(track, 10, 8)
+		song--
+	}
+	if err != nil || song > 0xFF {
+		return entry, fmt.Errorf("invalid track: %q", track)
+	}
+	entry.Song = byte(song)
+	entry.Title = fields[2]
+
+	if entry.Length, err = parseNEZplugOptionalTime(fields[3]); err != nil {
+		return entry, err
+	}
+	if entry.Fade, err = parseNEZplugOptionalTime(fields[5]); err != nil {
+		return entry, err
+	}
+
+	// the loop is its start ("0:30"), or its length counted back from the
+	// end of the song ("0:30-")
+	loopField := fields[4]
+	loopFromEnd := strings.HasSuffix(loopField, "-")
+	loop, err := parseNEZplugOptionalTime(strings.TrimSuffix(loopField, "-"))
+	if err != nil {
+		return entry, err
+	}
+	loopCount, err := strconv.Atoi(fields[6])
+	if err != nil || loopCount <= 1 || loop < 0 || entry.Length <= 0 {
+		return entry, nil
+	}
+	loopLength := loop
+	if !loopFromEnd {
+		loopLength = entry.Length - loop
+	}
+	if loopLength <= 0 || loopLength > entry.Length {
+		return entry, fmt.Errorf("invalid loop: %q", loopField)
+	}
+	entry.Length += loopLength * time.Duration(loopCount-1)
+	return entry, nil
+}
+
+// splitNEZplugFields splits the fields at the commas which are not escaped.
+func splitNEZplugFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case line[i] == ',':
+			fields = append(fields, strings.TrimSpace(field.String()))
+			field.Reset()
+		default:
+			field.WriteByte(line[i])
+		}
+	}
+	return append(fields, strings.TrimSpace(field.String()))
+}
+
+// parseNEZplugOptionalTime parses a time field, NSFUnknownLength when it is
+// empty.
+func parseNEZplugOptionalTime(s string) (time.Duration, error) {
+	if s == "" {
+		return NSFUnknownLength, nil
+	}
+	return parseNEZplugTime(s)
+}
+
+func parseNEZplugTime(s string) (time.Duration, error) {
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid time: %q", s)
+		}
+		seconds = seconds*60 + value
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Entry returns the current entry.
+func (p *NSFPlaylist) Entry() NSFPlaylistEntry {
+	return p.Entries[p.Current]
+}
+
+// Next moves to the next entry (after the last one: the first one).
+func (p *NSFPlaylist) Next() NSFPlaylistEntry {
+	p.Current = (p.Current + 1) % len(p.Entries)
+	return p.Entry()
+}
+
+// Prev moves to the previous entry (before the first one: the last one).
+func (p *NSFPlaylist) Prev() NSFPlaylistEntry {
+	p.Current = (p.Current + len(p.Entries) - 1) % len(p.Entries)
+	return p.Entry()
+}
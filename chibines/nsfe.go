@@ -0,0 +1,130 @@
+// refs: https://www.nesdev.org/wiki/NSFe
+package chibines
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const nsfeSignature = "NSFE"
+
+// default play speed of NSFe files without a RATE chunk (1/60.1 s)
+const nsfeDefaultPlaySpeed = 16639
+
+// parseNSFeFileInfo parses an NSFe file: a list of chunks (size, id, data)
+// converted to the NSF header and its track metadata.
+func parseNSFeFileInfo(data []byte) (*NSFFileInfo, error) {
+	header := NSFFileHeader{
+		Version:       1,
+		PlaySpeedNTSC: nsfeDefaultPlaySpeed,
+	}
+	copy(header.Header[:], nsfeSignature)
+
+	var info, rom []byte
+	var names []string
+	var times, fades []int32
+	var playlist []byte
+
+	pos := len(nsfeSignature)
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		id := string(data[pos+4 : pos+8])
+		pos += 8
+		if size < 0 || pos+size > len(data) {
+			return nil, errors.New("invalid .nsfe file: unexpected end of file")
+		}
+		chunk := data[pos : pos+size]
+		pos += size
+
+		switch id {
+		case "INFO":
+			info = chunk
+		case "DATA":
+			rom = chunk
+		case "BANK":
+			copy(header.BankSetup[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				header.PlaySpeedNTSC = binary.LittleEndian.Uint16(chunk)
+			}
+		case "auth":
+			fields := nsfeStrings(chunk)
+			for i, field := range []*[32]byte{&header.SongName, &header.ArtistName, &header.CopyrightHolder} {
+				if i < len(fields) {
+					copy(field[:31], fields[i])
+				}
+			}
+		case "tlbl":
+			names = nsfeStrings(chunk)
+		case "time":
+			times = nsfeInt32s(chunk)
+		case "fade":
+			fades = nsfeInt32s(chunk)
+		case "plst":
+			playlist = chunk
+		case "NEND":
+			pos = len(data)
+		default:
+			// chunks starting with an uppercase letter must be understood
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return nil, fmt.Errorf("unsupported .nsfe file: %s chunk", id)
+			}
+		}
+	}
+
+	if len(info) < 9 || rom == nil {
+		return nil, errors.New("invalid .nsfe file: no INFO or DATA chunk")
+	}
+	header.LoadAddress = binary.LittleEndian.Uint16(info[0:])
+	header.InitAddress = binary.LittleEndian.Uint16(info[2:])
+	header.PlayAddress = binary.LittleEndian.Uint16(info[4:])
+	header.Flags = info[6]
+	header.SoundChips = info[7]
+	header.TotalSongs = info[8]
+	header.StartingSong = 1
+	if len(info) >= 10 {
+		// 0 = first song in NSFe, 1 in NSF
+		header.StartingSong = info[9] + 1
+	}
+
+	nsfFileInfo := newNSFFileInfo(&header, rom)
+	for i := range nsfFileInfo.Tracks {
+		track := &nsfFileInfo.Tracks[i]
+		if i < len(names) {
+			track.Name = names[i]
+		}
+		if i < len(times) && times[i] >= 0 {
+			track.Length = time.Duration(times[i]) * time.Millisecond
+		}
+		if i < len(fades) && fades[i] >= 0 {
+			track.Fade = time.Duration(fades[i]) * time.Millisecond
+		}
+	}
+	for _, song := range playlist {
+		if song < header.TotalSongs {
+			nsfFileInfo.Playlist = append(nsfFileInfo.Playlist, song)
+		}
+	}
+	return nsfFileInfo, nil
+}
+
+// nsfeStrings splits NUL-terminated strings.
+func nsfeStrings(chunk []byte) []string {
+	fields := bytes.Split(bytes.TrimSuffix(chunk, []byte{0}), []byte{0})
+	strings := make([]string, len(fields))
+	for i, field := range fields {
+		strings[i] = string(field)
+	}
+	return strings
+}
+
+func nsfeInt32s(chunk []byte) []int32 {
+	values := make([]int32, len(chunk)/4)
+	for i := range values {
+		values[i] = int32(binary.LittleEndian.Uint32(chunk[i*4:]))
+	}
+	return values
+}
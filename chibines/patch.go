@@ -0,0 +1,386 @@
+// ORIGINAL
+package chibines
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Soft-patch formats
+// http://fileformats.archiveteam.org/wiki/IPS_(binary_patch_format)
+// https://www.romhacking.net/documents/392/ (UPS)
+// https://www.romhacking.net/documents/746/ (BPS)
+const (
+	ipsFileMagic = "PATCH"
+	ipsEOFMagic  = "EOF"
+	upsFileMagic = "UPS1"
+	bpsFileMagic = "BPS1"
+
+	// patched ROMs larger than this are rejected (the largest NES ROMs are a
+	// few MB)
+	maxPatchTargetSize = 64 * 1024 * 1024
+)
+
+// extensions searched beside the ROM file, in order of preference
+var patchFileExtensions = []string{".bps", ".ups", ".ips"}
+
+// FindPatchFile returns the path of a patch file (game.bps, game.ups or
+// game.ips) next to the given ROM file, or "" if there is none.
+func FindPatchFile(romFilePath string) string {
+	romFileName := fileNameWithoutExtension(romFilePath)
+	romFileDir := filepath.Dir(filepath.Clean(romFilePath))
+
+	for _, ext := range patchFileExtensions {
+		for _, e := range []string{ext, strings.ToUpper(ext)} {
+			patchPath := filepath.Join(romFileDir, romFileName+e)
+			if stat, err := os.Stat(patchPath); err == nil && !stat.IsDir() {
+				return patchPath
+			}
+		}
+	}
+
+	return ""
+}
+
+// ReadROMFile reads a ROM file and applies a patch to it in memory.
+// If patchPath is empty, a patch beside the ROM file is used when present.
+func ReadROMFile(romFilePath string, patchPath string) ([]byte, error) {
+	rom, err := os.ReadFile(romFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if patchPath == "" {
+		patchPath = FindPatchFile(romFilePath)
+		if patchPath == "" {
+			return rom, nil
+		}
+	}
+
+	patch, err := os.ReadFile(patchPath)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := ApplyPatch(rom, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(patchPath), err)
+	}
+	log.Printf("Patch: applied. Path: %s\n", patchPath)
+
+	return patched, nil
+}
+
+// ApplyPatch detects the patch format (IPS, UPS or BPS) and returns
+// the patched copy of rom. rom itself is not modified.
+func ApplyPatch(rom []byte, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(ipsFileMagic)):
+		return ApplyIPSPatch(rom, patch)
+	case bytes.HasPrefix(patch, []byte(upsFileMagic)):
+		return ApplyUPSPatch(rom, patch)
+	case bytes.HasPrefix(patch, []byte(bpsFileMagic)):
+		return ApplyBPSPatch(rom, patch)
+	}
+	return nil, errors.New("unknown patch format")
+}
+
+// ApplyIPSPatch applies an IPS patch (including RLE records and the
+// truncation extension).
+func ApplyIPSPatch(rom []byte, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, []byte(ipsFileMagic)) {
+		return nil, errors.New("invalid IPS patch")
+	}
+
+	target := make([]byte, len(rom))
+	copy(target, rom)
+
+	// grows target when a record writes past its end
+	write := func(offset int, data []byte) {
+		if end := offset + len(data); end > len(target) {
+			target = append(target, make([]byte, end-len(target))...)
+		}
+		copy(target[offset:], data)
+	}
+
+	pos := len(ipsFileMagic)
+	for {
+		if pos+3 > len(patch) {
+			return nil, errors.New("invalid IPS patch: unexpected end of file")
+		}
+		if string(patch[pos:pos+3]) == ipsEOFMagic {
+			pos += 3
+			break
+		}
+
+		offset := int(patch[pos])<<16 | int(patch[pos+1])<<8 | int(patch[pos+2])
+		pos += 3
+		if pos+2 > len(patch) {
+			return nil, errors.New("invalid IPS patch: unexpected end of file")
+		}
+		size := int(binary.BigEndian.Uint16(patch[pos:]))
+		pos += 2
+
+		if size == 0 {
+			// RLE record
+			if pos+3 > len(patch) {
+				return nil, errors.New("invalid IPS patch: unexpected end of file")
+			}
+			count := int(binary.BigEndian.Uint16(patch[pos:]))
+			value := patch[pos+2]
+			pos += 3
+			write(offset, bytes.Repeat([]byte{value}, count))
+		} else {
+			if pos+size > len(patch) {
+				return nil, errors.New("invalid IPS patch: unexpected end of file")
+			}
+			write(offset, patch[pos:pos+size])
+			pos += size
+		}
+	}
+
+	// truncation extension (Lunar IPS)
+	if pos+3 <= len(patch) {
+		size := int(patch[pos])<<16 | int(patch[pos+1])<<8 | int(patch[pos+2])
+		if size < len(target) {
+			target = target[:size]
+		}
+	}
+
+	return target, nil
+}
+
+// patchReader reads the variable-length integers shared by UPS and BPS.
+type patchReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *patchReader) readByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, errors.New("unexpected end of file")
+	}
+	v := r.data[r.pos]
+	r.pos++
+	return v, nil
+}
+
+func (r *patchReader) readNumber() (uint64, error) {
+	var data uint64
+	var shift uint64 = 1
+	for {
+		x, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+		data += uint64(x&0x7F) * shift
+		if (x & 0x80) == 0x80 {
+			break
+		}
+		shift <<= 7
+		data += shift
+	}
+	return data, nil
+}
+
+// patchFooter returns the source, target and patch CRC32 stored in the last 12 bytes.
+func patchFooter(patch []byte) (uint32, uint32, uint32) {
+	footer := patch[len(patch)-12:]
+	return binary.LittleEndian.Uint32(footer[0:]),
+		binary.LittleEndian.Uint32(footer[4:]),
+		binary.LittleEndian.Uint32(footer[8:])
+}
+
+func verifyPatchChecksums(format string, rom []byte, patch []byte) (uint32, error) {
+	sourceCRC, targetCRC, patchCRC := patchFooter(patch)
+	if crc := crc32.ChecksumIEEE(patch[:len(patch)-4]); crc != patchCRC {
+		return 0, fmt.Errorf("%s patch is corrupted: patch CRC32 mismatch (expected %08X, got %08X)", format, patchCRC, crc)
+	}
+	if crc := crc32.ChecksumIEEE(rom); crc != sourceCRC {
+		return 0, fmt.Errorf("%s patch does not match this ROM: source CRC32 mismatch (expected %08X, got %08X)", format, sourceCRC, crc)
+	}
+	return targetCRC, nil
+}
+
+// ApplyUPSPatch applies a UPS patch after validating the source ROM CRC32.
+func ApplyUPSPatch(rom []byte, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, []byte(upsFileMagic)) || len(patch) < len(upsFileMagic)+12 {
+		return nil, errors.New("invalid UPS patch")
+	}
+
+	targetCRC, err := verifyPatchChecksums("UPS", rom, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &patchReader{data: patch[:len(patch)-12], pos: len(upsFileMagic)}
+	sourceSize, err := r.readNumber()
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPS patch: %w", err)
+	}
+	targetSize, err := r.readNumber()
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPS patch: %w", err)
+	}
+	if sourceSize != uint64(len(rom)) {
+		return nil, fmt.Errorf("UPS patch does not match this ROM: source size mismatch (expected %d, got %d)", sourceSize, len(rom))
+	}
+	if targetSize > maxPatchTargetSize {
+		return nil, fmt.Errorf("invalid UPS patch: target size too large (%d)", targetSize)
+	}
+
+	target := make([]byte, targetSize)
+	copy(target, rom)
+
+	var offset uint64
+	for r.pos < len(r.data) {
+		relative, err := r.readNumber()
+		if err != nil {
+			return nil, fmt.Errorf("invalid UPS patch: %w", err)
+		}
+		offset += relative
+
+		for {
+			x, err := r.readByte()
+			if err != nil {
+				return nil, fmt.Errorf("invalid UPS patch: %w", err)
+			}
+			if offset < targetSize {
+				target[offset] ^= x
+			}
+			offset++
+			if x == 0 {
+				break
+			}
+		}
+	}
+
+	if crc := crc32.ChecksumIEEE(target); crc != targetCRC {
+		return nil, fmt.Errorf("UPS patch failed: target CRC32 mismatch (expected %08X, got %08X)", targetCRC, crc)
+	}
+
+	return target, nil
+}
+
+const (
+	bpsSourceRead byte = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// ApplyBPSPatch applies a BPS patch after validating the source ROM CRC32.
+func ApplyBPSPatch(rom []byte, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, []byte(bpsFileMagic)) || len(patch) < len(bpsFileMagic)+12 {
+		return nil, errors.New("invalid BPS patch")
+	}
+
+	targetCRC, err := verifyPatchChecksums("BPS", rom, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := func(err error) ([]byte, error) {
+		return nil, fmt.Errorf("invalid BPS patch: %w", err)
+	}
+
+	r := &patchReader{data: patch[:len(patch)-12], pos: len(bpsFileMagic)}
+	sourceSize, err := r.readNumber()
+	if err != nil {
+		return invalid(err)
+	}
+	targetSize, err := r.readNumber()
+	if err != nil {
+		return invalid(err)
+	}
+	metadataSize, err := r.readNumber()
+	if err != nil {
+		return invalid(err)
+	}
+	if metadataSize > uint64(len(r.data)-r.pos) {
+		return invalid(errors.New("unexpected end of file"))
+	}
+	r.pos += int(metadataSize)
+
+	if sourceSize != uint64(len(rom)) {
+		return nil, fmt.Errorf("BPS patch does not match this ROM: source size mismatch (expected %d, got %d)", sourceSize, len(rom))
+	}
+	if targetSize > maxPatchTargetSize {
+		return invalid(fmt.Errorf("target size too large (%d)", targetSize))
+	}
+
+	outOfRange := errors.New("offset out of range")
+	target := make([]byte, targetSize)
+	var outputOffset, sourceRelativeOffset, targetRelativeOffset int64
+	for r.pos < len(r.data) {
+		data, err := r.readNumber()
+		if err != nil {
+			return invalid(err)
+		}
+		command := byte(data & 0x03)
+		length := int64(data>>2) + 1
+
+		if outputOffset+length > int64(targetSize) {
+			return invalid(outOfRange)
+		}
+
+		switch command {
+		case bpsSourceRead:
+			if outputOffset+length > int64(len(rom)) {
+				return invalid(outOfRange)
+			}
+			copy(target[outputOffset:outputOffset+length], rom[outputOffset:])
+			outputOffset += length
+		case bpsTargetRead:
+			if r.pos+int(length) > len(r.data) {
+				return invalid(errors.New("unexpected end of file"))
+			}
+			copy(target[outputOffset:outputOffset+length], r.data[r.pos:])
+			r.pos += int(length)
+			outputOffset += length
+		case bpsSourceCopy, bpsTargetCopy:
+			d, err := r.readNumber()
+			if err != nil {
+				return invalid(err)
+			}
+			relative := int64(d >> 1)
+			if (d & 0x01) == 0x01 {
+				relative = -relative
+			}
+
+			if command == bpsSourceCopy {
+				sourceRelativeOffset += relative
+				if sourceRelativeOffset < 0 || sourceRelativeOffset+length > int64(len(rom)) {
+					return invalid(outOfRange)
+				}
+				copy(target[outputOffset:outputOffset+length], rom[sourceRelativeOffset:])
+				sourceRelativeOffset += length
+				outputOffset += length
+			} else {
+				targetRelativeOffset += relative
+				if targetRelativeOffset < 0 || targetRelativeOffset >= outputOffset {
+					return invalid(outOfRange)
+				}
+				// byte by byte: the source range may overlap the output (RLE)
+				for i := int64(0); i < length; i++ {
+					target[outputOffset] = target[targetRelativeOffset]
+					outputOffset++
+					targetRelativeOffset++
+				}
+			}
+		}
+	}
+
+	if crc := crc32.ChecksumIEEE(target); crc != targetCRC {
+		return nil, fmt.Errorf("BPS patch failed: target CRC32 mismatch (expected %08X, got %08X)", targetCRC, crc)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,95 @@
+// refs: github.com/libretro/Mesen
+package chibines
+
+// Power Pad / Family Trainer Mat
+// https://www.nesdev.org/wiki/Power_Pad
+//
+// Button numbers (side B): 1-4 (top row), 5-8 (middle row), 9-12 (bottom row)
+const PowerPadButtons = 12
+
+// PowerPad is the NES Power Pad (controller port) or, with famicom set,
+// the Family Trainer Mat (expansion port).
+// NES:
+// D3: buttons 2, 1, 5, 9, 6, 10, 11, 7 (serial)
+// D4: buttons 4, 3, 12, 8 (serial, then 1s)
+// Famicom:
+// $4016 bits 0-2: row select (active low)
+// $4017 D1-D4: buttons of the selected rows (active low)
+type PowerPad struct {
+	famicom bool
+
+	buttons [PowerPadButtons]bool
+	strobe  byte
+	reportL byte
+	reportH byte
+}
+
+func NewPowerPad(famicom bool) *PowerPad {
+	return &PowerPad{
+		famicom: famicom,
+	}
+}
+
+// SetButtons sets the state of buttons 1-12 (index 0-11).
+func (p *PowerPad) SetButtons(buttons [PowerPadButtons]bool) {
+	p.buttons = buttons
+}
+
+func (p *PowerPad) button(number int) byte {
+	if p.buttons[number-1] {
+		return 1
+	}
+	return 0
+}
+
+func (p *PowerPad) reload() {
+	p.reportL = p.button(2) | p.button(1)<<1 | p.button(5)<<2 | p.button(9)<<3 |
+		p.button(6)<<4 | p.button(10)<<5 | p.button(11)<<6 | p.button(7)<<7
+	p.reportH = p.button(4) | p.button(3)<<1 | p.button(12)<<2 | p.button(8)<<3 | 0xF0
+}
+
+func (p *PowerPad) Read(address uint16) byte {
+	if p.famicom {
+		return p.readMatrix(address)
+	}
+
+	if p.strobe&1 == 1 {
+		p.reload()
+	}
+
+	value := (p.reportL&0x01)<<3 | (p.reportH&0x01)<<4
+	p.reportL = (p.reportL >> 1) | 0x80
+	p.reportH = (p.reportH >> 1) | 0x80
+	return value
+}
+
+func (p *PowerPad) readMatrix(address uint16) byte {
+	if address != 0x4017 {
+		return 0
+	}
+
+	value := byte(0x1E)
+	for row := 0; row < 3; row++ {
+		if (p.strobe>>row)&0x01 == 0x01 {
+			// row not selected
+			continue
+		}
+		for column := 0; column < 4; column++ {
+			if p.buttons[row*4+column] {
+				value &= ^(byte(0x02) << column)
+			}
+		}
+	}
+	return value
+}
+
+func (p *PowerPad) Write(value byte) {
+	prev := p.strobe
+	p.strobe = value
+	if !p.famicom && prev&1 == 1 && p.strobe&1 == 0 {
+		p.reload()
+	}
+}
+
+func (p *PowerPad) UpdateFrame() {
+}
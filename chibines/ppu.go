@@ -87,7 +87,13 @@ type PPU struct {
 	secondarySpriteRAM [32]byte  // 0x20
 	hasSprite          [257]bool
 	front              *image.RGBA
-	back               *image.RGBA
+	palette            *Palette
+
+	// 9-bit pixels (emphasis << 6 | palette index), converted to RGB with
+	// palette at the end of each frame
+	outputBuffers        [2][]uint16
+	currentOutputBuffer  []uint16
+	previousOutputBuffer []uint16
 
 	standardVblankEnd   uint16
 	standardNMIScanline uint16
@@ -146,9 +152,12 @@ type PPU struct {
 }
 
 func NewPPU(console *Console) *PPU {
-	ppu := PPU{console: console}
+	ppu := PPU{console: console, palette: DefaultPalette}
 	ppu.front = image.NewRGBA(image.Rect(0, 0, 256, 240))
-	ppu.back = image.NewRGBA(image.Rect(0, 0, 256, 240))
+	ppu.outputBuffers[0] = make([]uint16, 256*240)
+	ppu.outputBuffers[1] = make([]uint16, 256*240)
+	ppu.currentOutputBuffer = ppu.outputBuffers[0]
+	ppu.previousOutputBuffer = ppu.outputBuffers[1]
 
 	var powerupPalette [32]byte = [32]byte{
 		0x09, 0x01, 0x00, 0x01, 0x00, 0x02, 0x02, 0x0D,
@@ -213,14 +222,11 @@ func (ppu *PPU) UpdateGrayscaleAndIntensifyBits() {
 	}
 
 	if ppu.lastUpdatedPixel < int32(pixelNumber) {
-		// uint16_t *out = _currentOutputBuffer + _lastUpdatedPixel + 1;
-		// while(_lastUpdatedPixel < pixelNumber) {
-		// 	*out = (*out & _paletteRamMask) | _intensifyColorBits;
-		// 	out++;
-		// 	_lastUpdatedPixel++;
-		// }
+		mask := uint16(ppu.paletteRAMMask)
 		for ppu.lastUpdatedPixel < int32(pixelNumber) {
 			ppu.lastUpdatedPixel++
+			out := &ppu.currentOutputBuffer[ppu.lastUpdatedPixel]
+			*out = (*out & mask) | ppu.intensifyColorBits
 		}
 	}
 }
@@ -977,13 +983,12 @@ func (ppu *PPU) DrawPixel() {
 		} else {
 			palette = ppu.paletteRAM[0]
 		}
-		c := Palette[palette]
-		ppu.back.SetRGBA(x, y, c)
+		// grayscale and emphasis are applied by UpdateGrayscaleAndIntensifyBits
+		ppu.currentOutputBuffer[(y<<8)+x] = uint16(palette)
 	} else {
 		// "If the current VRAM address points in the range $3F00-$3FFF during forced blanking, the color indicated by this palette location will be shown on screen instead of the backdrop color."
 		palette := ppu.paletteRAM[ppu.state.VideoRAMAddr&0x1F]
-		c := Palette[palette]
-		ppu.back.SetRGBA(x, y, c)
+		ppu.currentOutputBuffer[(y<<8)+x] = uint16(palette)
 	}
 }
 
@@ -1099,12 +1104,13 @@ func (ppu *PPU) Step() {
 		if ppu.ScanLine == -1 {
 			ppu.statusFlags.SpriteOverflow = false
 			ppu.statusFlags.Sprite0Hit = false
-
-			ppu.swapBuffer()
 		} else if ppu.ScanLine == 240 {
 			ppu.SetBusAddress(ppu.state.VideoRAMAddr)
 
+			ppu.sendFrame()
+			ppu.console.APU.flushSamples()
 			ppu.Frame++
+			ppu.console.CPU.bus.updateInputDevices()
 		}
 	} else {
 		ppu.Cycle++
@@ -1193,6 +1199,29 @@ func (ppu *PPU) GetFrameCycle() uint32 {
 	return ((uint32(ppu.ScanLine) + 1) * 341) + ppu.Cycle
 }
 
-func (ppu *PPU) swapBuffer() {
-	ppu.front, ppu.back = ppu.back, ppu.front
+// PixelBrightness returns R+G+B of a pixel of the frame being drawn.
+func (ppu *PPU) PixelBrightness(x, y int) int {
+	c := ppu.palette[ppu.currentOutputBuffer[(y<<8)+x]&0x1FF]
+	return int(c.R) + int(c.G) + int(c.B)
+}
+
+func (ppu *PPU) sendFrame() {
+	ppu.UpdateGrayscaleAndIntensifyBits()
+
+	pix := ppu.front.Pix
+	for i, pixel := range ppu.currentOutputBuffer {
+		c := ppu.palette[pixel&0x1FF]
+		pix[i*4] = c.R
+		pix[i*4+1] = c.G
+		pix[i*4+2] = c.B
+		pix[i*4+3] = c.A
+	}
+
+	ppu.previousOutputBuffer, ppu.currentOutputBuffer = ppu.currentOutputBuffer, ppu.previousOutputBuffer
+}
+
+// OutputBuffer returns the 9-bit pixels (emphasis << 6 | palette index)
+// of the last frame.
+func (ppu *PPU) OutputBuffer() []uint16 {
+	return ppu.previousOutputBuffer
 }
@@ -0,0 +1,174 @@
+// refs: https://www.nesdev.org/wiki/NTSC_video
+package chibines
+
+import (
+	"image"
+	"math"
+)
+
+// NTSC composite video filter
+//
+// The composite signal of each scanline is rebuilt from the 9-bit pixels of
+// the PPU (8 samples per pixel, 12 samples per color cycle) and decoded like
+// a TV: luma with a 12 sample window and chroma with a 24 sample window by
+// default, which gives the color bleeding, fringing and dot crawl of a
+// composite connection. Sharpness and Fringing of NTSCPaletteOptions change
+// the widths of the windows.
+const (
+	// NTSCFilterWidth is the output width for 256 pixels (same as nes_ntsc).
+	NTSCFilterWidth = 602
+
+	ntscSamplesPerPixel = 8
+	ntscLumaWindow      = 12
+	ntscChromaWindow    = 24
+	ntscMaxLumaWindow   = ntscLumaWindow * 2
+	ntscMaxChromaWindow = ntscChromaWindow * 2
+	ntscPadding         = ntscMaxChromaWindow
+	ntscGammaTableSize  = 1024
+)
+
+type NTSCFilter struct {
+	options NTSCPaletteOptions
+
+	signal     [paletteColors][12]float64 // adjusted signal of each pixel at each phase
+	black      float64
+	cos        [12]float64
+	sin        [12]float64
+	gammaTable [ntscGammaTableSize + 1]byte
+
+	lumaWindow   int
+	chromaWindow int
+
+	framePhase int
+	image      *image.RGBA
+
+	// prefix sums of a scanline
+	sumY []float64
+	sumI []float64
+	sumQ []float64
+}
+
+func NewNTSCFilter(options NTSCPaletteOptions) *NTSCFilter {
+	f := &NTSCFilter{}
+	f.SetOptions(options)
+	return f
+}
+
+func (f *NTSCFilter) Options() NTSCPaletteOptions {
+	return f.options
+}
+
+func (f *NTSCFilter) SetOptions(options NTSCPaletteOptions) {
+	f.options = options
+
+	for pixel := range f.signal {
+		for phase := range f.signal[pixel] {
+			f.signal[pixel][phase] = options.adjust(ntscSignal(pixel, phase))
+		}
+	}
+	f.black = options.adjust(0)
+
+	hue := options.Hue / 30
+	for phase := 0; phase < 12; phase++ {
+		f.cos[phase] = math.Cos(math.Pi / 6 * (float64(phase) + hue))
+		f.sin[phase] = math.Sin(math.Pi / 6 * (float64(phase) + hue))
+	}
+
+	for i := range f.gammaTable {
+		v := float64(i) / ntscGammaTableSize
+		f.gammaTable[i] = clampColor(255.95 * math.Pow(v, 2.2/options.Gamma))
+	}
+
+	// a narrower luma window keeps the edges, a narrower chroma window lets
+	// more luma through as color (fringing)
+	f.lumaWindow = ntscWindow(ntscLumaWindow*(1-options.Sharpness/2), ntscMaxLumaWindow)
+	f.chromaWindow = ntscWindow(ntscChromaWindow*(1-options.Fringing/2), ntscMaxChromaWindow)
+}
+
+// ntscWindow rounds a window width to an even number of samples (2 to max).
+func ntscWindow(width float64, max int) int {
+	w := int(math.Round(width/2)) * 2
+	if w < 2 {
+		return 2
+	}
+	if w > max {
+		return max
+	}
+	return w
+}
+
+func (f *NTSCFilter) gammaFix(v float64) byte {
+	if v <= 0 {
+		return f.gammaTable[0]
+	}
+	if v >= 1 {
+		return f.gammaTable[ntscGammaTableSize]
+	}
+	return f.gammaTable[int(v*ntscGammaTableSize)]
+}
+
+// Filter decodes a frame of 9-bit pixels (256 pixels per line, see
+// Console.OutputBuffer) to a NTSCFilterWidth wide image. The returned image
+// is reused by the next call.
+func (f *NTSCFilter) Filter(pixels []uint16) *image.RGBA {
+	height := len(pixels) / 256
+	if f.image == nil || f.image.Rect.Dy() != height {
+		f.image = image.NewRGBA(image.Rect(0, 0, NTSCFilterWidth, height))
+	}
+
+	for y := 0; y < height; y++ {
+		// each scanline is 341 * 8 samples: the phase moves by 4 every line
+		phase := (f.framePhase + y*4) % 12
+		f.filterLine(pixels[y*256:(y+1)*256], phase, f.image.Pix[y*f.image.Stride:])
+	}
+
+	// and by 4 every frame (dot crawl)
+	f.framePhase = (f.framePhase + 4) % 12
+
+	return f.image
+}
+
+func (f *NTSCFilter) filterLine(pixels []uint16, startPhase int, out []byte) {
+	samples := len(pixels) * ntscSamplesPerPixel
+	total := samples + ntscPadding*2
+	if len(f.sumY) < total+1 {
+		f.sumY = make([]float64, total+1)
+		f.sumI = make([]float64, total+1)
+		f.sumQ = make([]float64, total+1)
+	}
+
+	// the padding is blanking (black)
+	phase := ((startPhase-ntscPadding)%12 + 12) % 12
+	for k := 0; k < total; k++ {
+		v := f.black
+		if s := k - ntscPadding; s >= 0 && s < samples {
+			v = f.signal[pixels[s/ntscSamplesPerPixel]&0x1FF][phase]
+		}
+		f.sumY[k+1] = f.sumY[k] + v
+		f.sumI[k+1] = f.sumI[k] + v*f.cos[phase]
+		f.sumQ[k+1] = f.sumQ[k] + v*f.sin[phase]
+
+		phase++
+		if phase == 12 {
+			phase = 0
+		}
+	}
+
+	saturation := f.options.Saturation
+	lumaWindow, chromaWindow := f.lumaWindow, f.chromaWindow
+	for x := 0; x < NTSCFilterWidth; x++ {
+		center := ntscPadding + (2*x+1)*samples/(2*NTSCFilterWidth)
+
+		a := center - lumaWindow/2
+		y := (f.sumY[a+lumaWindow] - f.sumY[a]) / float64(lumaWindow)
+
+		b := center - chromaWindow/2
+		i := (f.sumI[b+chromaWindow] - f.sumI[b]) / float64(chromaWindow) * saturation
+		q := (f.sumQ[b+chromaWindow] - f.sumQ[b]) / float64(chromaWindow) * saturation
+
+		out[x*4] = f.gammaFix(y + 0.946882*i + 0.623557*q)
+		out[x*4+1] = f.gammaFix(y - 0.274788*i - 0.635691*q)
+		out[x*4+2] = f.gammaFix(y - 1.108545*i + 1.709007*q)
+		out[x*4+3] = 0xFF
+	}
+}
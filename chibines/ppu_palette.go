@@ -1,9 +1,23 @@
 // refs: github.com/fogleman/nes
 package chibines
 
-import "image/color"
+import (
+	"errors"
+	"image/color"
+	"os"
+)
 
-var Palette [64]color.RGBA
+// Palette is a 512-color table indexed by the 6-bit palette index and the
+// 3 emphasis bits of PPUMASK (emphasis << 6 | index).
+type Palette [512]color.RGBA
+
+const (
+	paletteBaseColors = 64
+	paletteColors     = 512
+)
+
+// DefaultPalette is the palette used by a new Console.
+var DefaultPalette *Palette
 
 func init() {
 	colors := [][]byte{
@@ -40,10 +54,101 @@ func init() {
 		{0xe4, 0xe5, 0x94}, {0xcf, 0xef, 0x96}, {0xbd, 0xf4, 0xab}, {0xb3, 0xf3, 0xcc},
 		{0xb5, 0xeb, 0xf2}, {0xb8, 0xb8, 0xb8}, {0x00, 0x00, 0x00}, {0x00, 0x00, 0x00},
 	}
+	rgba := make([]color.RGBA, len(colors))
 	for i, c := range colors {
 		r := c[0]
 		g := c[1]
 		b := c[2]
-		Palette[i] = color.RGBA{r, g, b, 0xFF}
+		rgba[i] = color.RGBA{r, g, b, 0xFF}
+	}
+	DefaultPalette, _ = NewPalette(rgba)
+}
+
+// NewPalette creates a palette from 64 colors (emphasis colors are
+// generated) or 512 colors (including emphasis combinations).
+func NewPalette(colors []color.RGBA) (*Palette, error) {
+	var palette Palette
+	switch len(colors) {
+	case paletteColors:
+		copy(palette[:], colors)
+	case paletteBaseColors:
+		copy(palette[:], colors)
+		palette.generateEmphasisColors()
+	default:
+		return nil, errors.New("palette must have 64 or 512 colors")
+	}
+	return &palette, nil
+}
+
+// ParsePalette parses the contents of a .pal file (64 or 512 RGB triplets).
+func ParsePalette(data []byte) (*Palette, error) {
+	if len(data) != paletteBaseColors*3 && len(data) != paletteColors*3 {
+		return nil, errors.New("invalid .pal file: 64 or 512 colors (192 or 1536 bytes) expected")
+	}
+
+	colors := make([]color.RGBA, len(data)/3)
+	for i := range colors {
+		colors[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xFF}
+	}
+	return NewPalette(colors)
+}
+
+func LoadPalette(path string) (*Palette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePalette(data)
+}
+
+// Bytes returns the palette in .pal format (512 RGB triplets).
+func (p *Palette) Bytes() []byte {
+	data := make([]byte, 0, paletteColors*3)
+	for _, c := range p {
+		data = append(data, c.R, c.G, c.B)
+	}
+	return data
+}
+
+// generateEmphasisColors fills entries 64-511 from the first 64 colors.
+func (p *Palette) generateEmphasisColors() {
+	for emphasis := 1; emphasis < 8; emphasis++ {
+		for i := 0; i < paletteBaseColors; i++ {
+			c := p[i]
+			r := float64(c.R)
+			g := float64(c.G)
+			b := float64(c.B)
+
+			if (emphasis & 0x01) != 0 {
+				// red
+				r *= 1.1
+				g *= 0.9
+				b *= 0.9
+			}
+			if (emphasis & 0x02) != 0 {
+				// green
+				r *= 0.9
+				g *= 1.1
+				b *= 0.9
+			}
+			if (emphasis & 0x04) != 0 {
+				// blue
+				r *= 0.9
+				g *= 0.9
+				b *= 1.1
+			}
+
+			p[emphasis<<6|i] = color.RGBA{clampColor(r), clampColor(g), clampColor(b), 0xFF}
+		}
+	}
+}
+
+func clampColor(v float64) byte {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
 	}
+	return byte(v)
 }
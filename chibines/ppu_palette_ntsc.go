@@ -0,0 +1,133 @@
+// refs: https://www.nesdev.org/wiki/NTSC_video (Bisqwit's palette generator)
+package chibines
+
+import (
+	"image/color"
+	"math"
+)
+
+// NTSCPaletteOptions are the TV controls of GenerateNTSCPalette.
+type NTSCPaletteOptions struct {
+	Hue        float64 // degrees
+	Saturation float64
+	Contrast   float64
+	Brightness float64
+	Gamma      float64 // gamma of the display (the NTSC signal assumes 2.2)
+
+	// used by NTSCFilter only
+	Sharpness float64 // -1 (blurry) to 1 (sharp): width of the luma window
+	Fringing  float64 // -1 (none) to 1 (strong): width of the chroma window
+}
+
+func DefaultNTSCPaletteOptions() NTSCPaletteOptions {
+	return NTSCPaletteOptions{
+		Hue:        0,
+		Saturation: 1.0,
+		Contrast:   1.0,
+		Brightness: 1.0,
+		Gamma:      1.8,
+		Sharpness:  0,
+		Fringing:   0,
+	}
+}
+
+// Voltage levels, relative to sync, of the PPU video signal.
+// Indexed by luma (0-3): low voltages, then high voltages.
+var ntscSignalLevels = [8]float64{
+	0.350, 0.518, 0.962, 1.550,
+	1.094, 1.506, 1.962, 1.962,
+}
+
+const (
+	ntscBlack       = 0.518
+	ntscWhite       = 1.962
+	ntscAttenuation = 0.746
+)
+
+// ntscInColorPhase reports whether the square wave of color (0-15) is high
+// at phase (12 phases per color cycle).
+func ntscInColorPhase(color, phase int) bool {
+	return (color+phase+8)%12 < 6
+}
+
+// ntscSignal returns the normalized voltage (0 = black, 1 = white) of pixel
+// (emphasis << 6 | palette index) at phase.
+func ntscSignal(pixel, phase int) float64 {
+	c := pixel & 0x0F
+	emphasis := pixel >> 6
+	level := (pixel >> 4) & 0x03
+	if c >= 0x0E {
+		level = 1
+	}
+
+	var lo, hi float64
+	lo = ntscSignalLevels[level]
+	hi = ntscSignalLevels[level+4]
+	if c == 0x00 {
+		lo = hi
+	}
+	if c >= 0x0D {
+		hi = lo
+	}
+
+	spot := lo
+	if ntscInColorPhase(c, phase) {
+		spot = hi
+	}
+	if ((emphasis&0x01) != 0 && ntscInColorPhase(0, phase)) ||
+		((emphasis&0x02) != 0 && ntscInColorPhase(4, phase)) ||
+		((emphasis&0x04) != 0 && ntscInColorPhase(8, phase)) {
+		spot *= ntscAttenuation
+	}
+
+	return (spot - ntscBlack) / (ntscWhite - ntscBlack)
+}
+
+// adjust applies contrast and brightness to a normalized signal.
+func (options *NTSCPaletteOptions) adjust(v float64) float64 {
+	return ((v-0.5)*options.Contrast + 0.5) * options.Brightness
+}
+
+// yiqToRGB converts a demodulated color (FCC) with gamma correction.
+func (options *NTSCPaletteOptions) yiqToRGB(y, i, q float64) color.RGBA {
+	gammaFix := func(v float64) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return math.Pow(v, 2.2/options.Gamma)
+	}
+
+	i *= options.Saturation
+	q *= options.Saturation
+	r := y + 0.946882*i + 0.623557*q
+	g := y - 0.274788*i - 0.635691*q
+	b := y - 1.108545*i + 1.709007*q
+
+	return color.RGBA{
+		clampColor(255.95 * gammaFix(r)),
+		clampColor(255.95 * gammaFix(g)),
+		clampColor(255.95 * gammaFix(b)),
+		0xFF,
+	}
+}
+
+// GenerateNTSCPalette decodes the NTSC signal of every palette index and
+// emphasis combination to RGB.
+func GenerateNTSCPalette(options NTSCPaletteOptions) *Palette {
+	var palette Palette
+
+	hue := options.Hue / 30
+	for pixel := 0; pixel < paletteColors; pixel++ {
+		// demodulate one color cycle
+		var y, i, q float64
+		for phase := 0; phase < 12; phase++ {
+			v := options.adjust(ntscSignal(pixel, phase)) / 12
+			y += v
+			i += v * math.Cos(math.Pi/6*(float64(phase)+hue))
+			q += v * math.Sin(math.Pi/6*(float64(phase)+hue))
+		}
+		palette[pixel] = options.yiqToRGB(y, i, q)
+	}
+
+	return &palette
+}
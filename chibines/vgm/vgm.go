@@ -0,0 +1,271 @@
+// ORIGINAL
+
+// Package vgm writes the APU register writes of a console as a VGM file
+// (NES APU chip, VGM 1.61), or VGZ (gzip-compressed VGM):
+//
+//	writer, err := vgm.NewWriter("music.vgz")
+//	console.SetAPURegisterLogger(writer)
+//	... run the console ...
+//	console.SetAPURegisterLogger(nil)
+//	err = writer.Close()
+//
+// https://vgmrips.net/wiki/VGM_Specification
+package vgm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+const (
+	version    = 0x161
+	headerSize = 0x100
+	sampleRate = 44100 // VGM time base
+
+	// NESClock is the clock of the NES APU written in the header (NTSC),
+	// and the time base of the cycles.
+	NESClock = chibines.CPUFrequency
+)
+
+// VGM commands
+const (
+	cmdWaitN       = 0x61 // wait n samples
+	cmdWait735     = 0x62 // wait 1/60 second
+	cmdWait882     = 0x63 // wait 1/50 second
+	cmdEnd         = 0x66
+	cmdDataBlock   = 0x67
+	cmdWaitShort   = 0x70 // 0x7n: wait n+1 samples
+	cmdNESAPU      = 0xB4 // register (address - $4000), value
+	blockNESAPURAM = 0xC2 // data block: RAM write (address, data)
+)
+
+// Tags are the GD3 tags of the file (English names only).
+type Tags struct {
+	Track  string
+	Game   string
+	System string // default: "Nintendo Entertainment System"
+	Author string
+	Date   string
+	Notes  string
+}
+
+// Writer implements chibines.APURegisterLogger. The commands are kept in
+// memory (a few hundred KB for a song) and written by Close.
+type Writer struct {
+	path string
+	gzip bool
+	tags Tags
+
+	data    bytes.Buffer
+	started bool
+	start   uint64 // cycle of the first write
+	samples uint64 // samples waited so far
+
+	// the sample memory known to the player ($8000-$FFFF), so that only
+	// new DPCM samples are written
+	ram   [0x8000]byte
+	known [0x8000]bool
+
+	ended bool
+}
+
+// NewWriter creates a log to path. A .vgz path is gzip-compressed. The file
+// is created now, to report errors early, and written by Close.
+func NewWriter(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		path: path,
+		gzip: strings.EqualFold(filepath.Ext(path), ".vgz"),
+		tags: Tags{System: "Nintendo Entertainment System"},
+	}, nil
+}
+
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// SetTags sets the GD3 tags. An empty System keeps the default.
+func (w *Writer) SetTags(tags Tags) {
+	if tags.System == "" {
+		tags.System = w.tags.System
+	}
+	w.tags = tags
+}
+
+// wait adds the wait commands up to cycle.
+func (w *Writer) wait(cycle uint64) {
+	if !w.started {
+		w.started = true
+		w.start = cycle
+	}
+	if w.ended {
+		return
+	}
+
+	// (no rounding error accumulates: the target is computed from the start)
+	target := (cycle - w.start) * sampleRate / NESClock
+	if target <= w.samples {
+		return
+	}
+	n := target - w.samples
+	w.samples = target
+
+	for n > 0 {
+		switch {
+		case n <= 16:
+			w.data.WriteByte(cmdWaitShort + byte(n-1))
+			n = 0
+		case n == 735:
+			w.data.WriteByte(cmdWait735)
+			n = 0
+		case n == 882:
+			w.data.WriteByte(cmdWait882)
+			n = 0
+		default:
+			wait := n
+			if wait > 0xFFFF {
+				wait = 0xFFFF
+			}
+			w.data.Write([]byte{cmdWaitN, byte(wait), byte(wait >> 8)})
+			n -= wait
+		}
+	}
+}
+
+// WriteRegister logs a register write ($4000-$401F).
+func (w *Writer) WriteRegister(cycle uint64, address uint16, value byte) {
+	if w.ended || address < 0x4000 || address > 0x401F {
+		return
+	}
+	w.wait(cycle)
+	w.data.Write([]byte{cmdNESAPU, byte(address - 0x4000), value})
+}
+
+// WriteSampleData logs the DPCM sample memory, unless the player already
+// has it.
+func (w *Writer) WriteSampleData(cycle uint64, address uint16, data []byte) {
+	if w.ended || address < 0x8000 || int(address)+len(data) > 0x10000 {
+		return
+	}
+
+	offset := int(address - 0x8000)
+	same := true
+	for i, b := range data {
+		if !w.known[offset+i] || w.ram[offset+i] != b {
+			same = false
+			break
+		}
+	}
+	if same {
+		return
+	}
+	copy(w.ram[offset:], data)
+	for i := range data {
+		w.known[offset+i] = true
+	}
+
+	w.wait(cycle)
+	var header [9]byte
+	header[0] = cmdDataBlock
+	header[1] = cmdEnd // compatibility byte
+	header[2] = blockNESAPURAM
+	binary.LittleEndian.PutUint32(header[3:], uint32(2+len(data)))
+	binary.LittleEndian.PutUint16(header[7:], address)
+	w.data.Write(header[:])
+	w.data.Write(data)
+}
+
+// EndLog ends the log at cycle: later writes are ignored.
+func (w *Writer) EndLog(cycle uint64) {
+	if w.ended {
+		return
+	}
+	w.wait(cycle)
+	w.ended = true
+}
+
+// gd3 returns the GD3 tag block.
+func (w *Writer) gd3() []byte {
+	var strs bytes.Buffer
+	for _, s := range []string{
+		w.tags.Track, "",
+		w.tags.Game, "",
+		w.tags.System, "",
+		w.tags.Author, "",
+		w.tags.Date,
+		"chibines", // converter
+		w.tags.Notes,
+	} {
+		for _, c := range utf16.Encode([]rune(s)) {
+			binary.Write(&strs, binary.LittleEndian, c)
+		}
+		strs.Write([]byte{0, 0})
+	}
+
+	gd3 := make([]byte, 12, 12+strs.Len())
+	copy(gd3, "Gd3 ")
+	binary.LittleEndian.PutUint32(gd3[4:], 0x100)
+	binary.LittleEndian.PutUint32(gd3[8:], uint32(strs.Len()))
+	return append(gd3, strs.Bytes()...)
+}
+
+// Close writes the file.
+func (w *Writer) Close() error {
+	if !w.started {
+		return errors.New("vgm: no register write logged")
+	}
+	w.ended = true
+
+	data := append(w.data.Bytes(), cmdEnd)
+	gd3 := w.gd3()
+	size := headerSize + len(data) + len(gd3)
+
+	header := make([]byte, headerSize)
+	copy(header, "Vgm ")
+	binary.LittleEndian.PutUint32(header[0x04:], uint32(size-0x04))
+	binary.LittleEndian.PutUint32(header[0x08:], version)
+	binary.LittleEndian.PutUint32(header[0x14:], uint32(headerSize+len(data)-0x14))
+	binary.LittleEndian.PutUint32(header[0x18:], uint32(w.samples))
+	binary.LittleEndian.PutUint32(header[0x24:], 60)
+	binary.LittleEndian.PutUint32(header[0x34:], headerSize-0x34)
+	binary.LittleEndian.PutUint32(header[0x84:], NESClock)
+
+	file, err := os.Create(w.path)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = file
+	var zw *gzip.Writer
+	if w.gzip {
+		zw = gzip.NewWriter(file)
+		out = zw
+	}
+	for _, b := range [][]byte{header, data, gd3} {
+		if _, err := out.Write(b); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
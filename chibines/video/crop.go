@@ -0,0 +1,52 @@
+// ORIGINAL
+package video
+
+import "image"
+
+const (
+	screenWidth  = 256
+	screenHeight = 240
+)
+
+// Crop is the overscan hidden on each edge, in NES pixels (of 256x240).
+type Crop struct {
+	Top    int
+	Bottom int
+	Left   int
+	Right  int
+}
+
+// Width returns the visible width in NES pixels.
+func (c Crop) Width() int {
+	return screenWidth - c.Left - c.Right
+}
+
+// Height returns the visible height in NES pixels.
+func (c Crop) Height() int {
+	return screenHeight - c.Top - c.Bottom
+}
+
+func (c Crop) valid() bool {
+	return c.Top >= 0 && c.Bottom >= 0 && c.Left >= 0 && c.Right >= 0 &&
+		c.Width() > 0 && c.Height() > 0
+}
+
+// Apply returns the visible part of a frame. The frame may be wider or
+// taller than 256x240 (e.g. chibines.NTSCFilter output); the crop is scaled
+// to its size.
+func (c Crop) Apply(img *image.RGBA) *image.RGBA {
+	if c == (Crop{}) || !c.valid() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w := bounds.Dx()
+	h := bounds.Dy()
+	rect := image.Rect(
+		bounds.Min.X+c.Left*w/screenWidth,
+		bounds.Min.Y+c.Top*h/screenHeight,
+		bounds.Max.X-c.Right*w/screenWidth,
+		bounds.Max.Y-c.Bottom*h/screenHeight,
+	)
+	return img.SubImage(rect).(*image.RGBA)
+}
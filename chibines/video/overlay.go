@@ -0,0 +1,137 @@
+// ORIGINAL
+package video
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Overlay is an effect drawn over the scaled frame. scale is the number of
+// output pixels per source pixel.
+type Overlay interface {
+	Name() string
+	apply(img *image.RGBA, scale int)
+}
+
+var overlays = []Overlay{
+	noneOverlay{},
+	&scanlineOverlay{intensity: 0.5},
+	&crtOverlay{scanlineIntensity: 0.4, maskIntensity: 0.25, brightness: 1.25},
+}
+
+// Overlays returns the names of all overlays.
+func Overlays() []string {
+	names := make([]string, len(overlays))
+	for i, o := range overlays {
+		names[i] = o.Name()
+	}
+	return names
+}
+
+func FindOverlay(name string) (Overlay, error) {
+	for _, o := range overlays {
+		if o.Name() == name {
+			return o, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown video overlay: %s", name)
+}
+
+type noneOverlay struct{}
+
+func (noneOverlay) Name() string {
+	return "none"
+}
+
+func (noneOverlay) apply(img *image.RGBA, scale int) {
+}
+
+// scanlineGains returns the brightness of each output row of a source
+// line: the lower half is darkened. With scale 1, every other row is.
+func scanlineGains(scale int, intensity float64) ([]float64, int) {
+	if scale == 1 {
+		return []float64{1, 1 - intensity}, 2
+	}
+
+	gains := make([]float64, scale)
+	for i := range gains {
+		// distance from the center of the beam, 0 - 1
+		d := math.Abs((float64(i)+0.5)/float64(scale)-0.5) * 2
+		gains[i] = 1 - intensity*d*d
+	}
+	return gains, scale
+}
+
+func multiplyRows(img *image.RGBA, gains []float64, period int) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		gain := gains[(y-bounds.Min.Y)%period]
+		if gain == 1 {
+			continue
+		}
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = byte(float64(row[i]) * gain)
+			row[i+1] = byte(float64(row[i+1]) * gain)
+			row[i+2] = byte(float64(row[i+2]) * gain)
+		}
+	}
+}
+
+// scanlineOverlay darkens the space between the lines of the picture.
+type scanlineOverlay struct {
+	intensity float64
+}
+
+func (o *scanlineOverlay) Name() string {
+	return "scanlines"
+}
+
+func (o *scanlineOverlay) apply(img *image.RGBA, scale int) {
+	gains, period := scanlineGains(scale, o.intensity)
+	multiplyRows(img, gains, period)
+}
+
+// crtOverlay adds scanlines and an aperture grille (vertical red, green and
+// blue stripes), and raises the brightness to make up for them.
+type crtOverlay struct {
+	scanlineIntensity float64
+	maskIntensity     float64
+	brightness        float64
+}
+
+func (o *crtOverlay) Name() string {
+	return "crt"
+}
+
+func (o *crtOverlay) apply(img *image.RGBA, scale int) {
+	gains, period := scanlineGains(scale, o.scanlineIntensity)
+
+	// the color of each stripe is kept, the others are darkened
+	var mask [3][3]float64
+	for stripe := range mask {
+		for channel := range mask[stripe] {
+			mask[stripe][channel] = o.brightness
+			if stripe != channel {
+				mask[stripe][channel] *= 1 - o.maskIntensity
+			}
+		}
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		gain := gains[(y-bounds.Min.Y)%period]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			m := &mask[(x-bounds.Min.X)%3]
+			for channel := 0; channel < 3; channel++ {
+				v := float64(img.Pix[i+channel]) * gain * m[channel]
+				if v > 255 {
+					v = 255
+				}
+				img.Pix[i+channel] = byte(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// ORIGINAL
+package video
+
+import "image"
+
+// Pixels are packed as 0x00RRGGBB.
+
+type yuv struct {
+	y, u, v int32
+}
+
+// source is a frame with clamped access to neighbors.
+type source struct {
+	width  int
+	height int
+	pixels []uint32
+	yuvs   []yuv
+}
+
+func (s *source) load(img *image.RGBA) {
+	bounds := img.Bounds()
+	s.width = bounds.Dx()
+	s.height = bounds.Dy()
+	if len(s.pixels) != s.width*s.height {
+		s.pixels = make([]uint32, s.width*s.height)
+		s.yuvs = make([]yuv, s.width*s.height)
+	}
+
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			i := img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			c := uint32(img.Pix[i])<<16 | uint32(img.Pix[i+1])<<8 | uint32(img.Pix[i+2])
+			s.pixels[y*s.width+x] = c
+			s.yuvs[y*s.width+x] = toYUV(c)
+		}
+	}
+}
+
+func (s *source) index(x, y int) int {
+	if x < 0 {
+		x = 0
+	} else if x >= s.width {
+		x = s.width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= s.height {
+		y = s.height - 1
+	}
+	return y*s.width + x
+}
+
+func (s *source) pixel(x, y int) uint32 {
+	return s.pixels[s.index(x, y)]
+}
+
+func (s *source) yuv(x, y int) yuv {
+	return s.yuvs[s.index(x, y)]
+}
+
+func setPixel(img *image.RGBA, x, y int, c uint32) {
+	i := y*img.Stride + x*4
+	img.Pix[i] = byte(c >> 16)
+	img.Pix[i+1] = byte(c >> 8)
+	img.Pix[i+2] = byte(c)
+	img.Pix[i+3] = 0xFF
+}
+
+func toYUV(c uint32) yuv {
+	r := int32(c>>16) & 0xFF
+	g := int32(c>>8) & 0xFF
+	b := int32(c) & 0xFF
+	return yuv{
+		y: (299*r + 587*g + 114*b) / 1000,
+		u: (-169*r-331*g+500*b)/1000 + 128,
+		v: (500*r-419*g-81*b)/1000 + 128,
+	}
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// distance is the YUV distance of xBR (sum of the differences).
+func distance(a, b yuv) int32 {
+	return abs32(a.y-b.y) + abs32(a.u-b.u) + abs32(a.v-b.v)
+}
+
+// mix blends a and b. w is the weight of b (0-256).
+func mix(a, b uint32, w int32) uint32 {
+	if w <= 0 {
+		return a
+	}
+	if w >= 256 {
+		return b
+	}
+	var c uint32
+	for shift := 0; shift <= 16; shift += 8 {
+		ca := int32(a>>shift) & 0xFF
+		cb := int32(b>>shift) & 0xFF
+		c |= uint32((ca*(256-w)+cb*w)>>8) << shift
+	}
+	return c
+}
+
+// rotate rotates an offset by r * 90 degrees.
+func rotate(dx, dy int, r int) (int, int) {
+	switch r & 3 {
+	case 1:
+		return -dy, dx
+	case 2:
+		return -dx, -dy
+	case 3:
+		return dy, -dx
+	}
+	return dx, dy
+}
@@ -0,0 +1,125 @@
+// refs: https://www.scale2x.it/algorithm
+package video
+
+import "image"
+
+// Scale2x / Scale3x / Scale4x (EPX)
+//
+// Scale4x is Scale2x applied twice.
+type scaleXFilter struct {
+	scale  int
+	tmp    *image.RGBA
+	tmpSrc source
+}
+
+func (f *scaleXFilter) Name() string {
+	switch f.scale {
+	case 3:
+		return "scale3x"
+	case 4:
+		return "scale4x"
+	}
+	return "scale2x"
+}
+
+func (f *scaleXFilter) Scale() int {
+	return f.scale
+}
+
+func (f *scaleXFilter) apply(dst *image.RGBA, src *source) {
+	switch f.scale {
+	case 3:
+		scale3x(dst, src)
+	case 4:
+		rect := image.Rect(0, 0, src.width*2, src.height*2)
+		if f.tmp == nil || f.tmp.Rect != rect {
+			f.tmp = image.NewRGBA(rect)
+		}
+		scale2x(f.tmp, src)
+		f.tmpSrc.load(f.tmp)
+		scale2x(dst, &f.tmpSrc)
+	default:
+		scale2x(dst, src)
+	}
+}
+
+func scale2x(dst *image.RGBA, src *source) {
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			b := src.pixel(x, y-1)
+			d := src.pixel(x-1, y)
+			e := src.pixel(x, y)
+			f := src.pixel(x+1, y)
+			h := src.pixel(x, y+1)
+
+			e0, e1, e2, e3 := e, e, e, e
+			if b != h && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == h {
+					e2 = d
+				}
+				if h == f {
+					e3 = f
+				}
+			}
+
+			setPixel(dst, x*2, y*2, e0)
+			setPixel(dst, x*2+1, y*2, e1)
+			setPixel(dst, x*2, y*2+1, e2)
+			setPixel(dst, x*2+1, y*2+1, e3)
+		}
+	}
+}
+
+func scale3x(dst *image.RGBA, src *source) {
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			a := src.pixel(x-1, y-1)
+			b := src.pixel(x, y-1)
+			c := src.pixel(x+1, y-1)
+			d := src.pixel(x-1, y)
+			e := src.pixel(x, y)
+			f := src.pixel(x+1, y)
+			g := src.pixel(x-1, y+1)
+			h := src.pixel(x, y+1)
+			i := src.pixel(x+1, y+1)
+
+			out := [9]uint32{e, e, e, e, e, e, e, e, e}
+			if b != h && d != f {
+				if d == b {
+					out[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+				if b == f {
+					out[2] = f
+				}
+				if (d == b && e != g) || (d == h && e != a) {
+					out[3] = d
+				}
+				if (b == f && e != i) || (h == f && e != c) {
+					out[5] = f
+				}
+				if d == h {
+					out[6] = d
+				}
+				if (d == h && e != i) || (h == f && e != g) {
+					out[7] = h
+				}
+				if h == f {
+					out[8] = f
+				}
+			}
+
+			for j, c := range out {
+				setPixel(dst, x*3+j%3, y*3+j/3, c)
+			}
+		}
+	}
+}
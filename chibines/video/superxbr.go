@@ -0,0 +1,221 @@
+// refs: https://github.com/libretro/common-shaders/tree/master/xbr/shaders/super-xbr
+package video
+
+import (
+	"image"
+	"math"
+)
+
+// Super-xBR by Hyllian
+//
+// An edge-directed 2x interpolation in two passes: the pixels between four
+// source pixels are interpolated along the diagonal with the least
+// variation, then the remaining pixels along the horizontal or vertical
+// line with the least variation. 4-tap filters make edges sharp and the
+// result is clamped to the nearest pixels to avoid ringing. 4x is 2x
+// applied twice.
+const (
+	superXBRWeight1 = 0.129633 // diagonal pass
+	superXBRWeight2 = 0.175068 // orthogonal pass
+)
+
+type superXBRFilter struct {
+	scale  int
+	grid   []rgbf
+	lumas  []float32
+	tmp    *image.RGBA
+	tmpSrc source
+}
+
+type rgbf struct {
+	r, g, b float32
+}
+
+func (c rgbf) luma() float32 {
+	return 0.299*c.r + 0.587*c.g + 0.114*c.b
+}
+
+func (f *superXBRFilter) Name() string {
+	if f.scale == 4 {
+		return "superxbr4x"
+	}
+	return "superxbr2x"
+}
+
+func (f *superXBRFilter) Scale() int {
+	return f.scale
+}
+
+func (f *superXBRFilter) apply(dst *image.RGBA, src *source) {
+	if f.scale != 4 {
+		f.scale2x(dst, src)
+		return
+	}
+
+	rect := image.Rect(0, 0, src.width*2, src.height*2)
+	if f.tmp == nil || f.tmp.Rect != rect {
+		f.tmp = image.NewRGBA(rect)
+	}
+	f.scale2x(f.tmp, src)
+	f.tmpSrc.load(f.tmp)
+	f.scale2x(dst, &f.tmpSrc)
+}
+
+func (f *superXBRFilter) scale2x(dst *image.RGBA, src *source) {
+	w := src.width * 2
+	h := src.height * 2
+	if len(f.grid) != w*h {
+		f.grid = make([]rgbf, w*h)
+		f.lumas = make([]float32, w*h)
+	}
+	grid := f.grid
+	lumas := f.lumas
+
+	// even / even: source pixels
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			c := src.pixel(x, y)
+			grid[(y*2)*w+x*2] = rgbf{float32(c >> 16 & 0xFF), float32(c >> 8 & 0xFF), float32(c & 0xFF)}
+			lumas[(y*2)*w+x*2] = grid[(y*2)*w+x*2].luma()
+		}
+	}
+
+	// clamped access keeping the parity of the coordinates
+	index := func(x, y int) int {
+		if x < 0 {
+			x &= 1
+		} else if x >= w {
+			x = w - 2 + (x & 1)
+		}
+		if y < 0 {
+			y &= 1
+		} else if y >= h {
+			y = h - 2 + (y & 1)
+		}
+		return y*w + x
+	}
+	at := func(x, y int) rgbf {
+		return grid[index(x, y)]
+	}
+	lumaAt := func(x, y int) float32 {
+		return lumas[index(x, y)]
+	}
+
+	// pass 1: odd / odd, between 4 source pixels
+	for y := 1; y < h; y += 2 {
+		for x := 1; x < w; x += 2 {
+			var p [4][4]rgbf
+			var l [4][4]float32
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					p[i][j] = at(x-3+i*2, y-3+j*2)
+					l[i][j] = lumaAt(x-3+i*2, y-3+j*2)
+				}
+			}
+
+			var d1, d2 float32 // variation along \ and /
+			for j := 0; j < 3; j++ {
+				for i := 0; i < 3; i++ {
+					d1 += abs(l[i][j] - l[i+1][j+1])
+					d2 += abs(l[i+1][j] - l[i][j+1])
+				}
+			}
+
+			c1 := filter4(p[0][0], p[1][1], p[2][2], p[3][3], superXBRWeight1)
+			c2 := filter4(p[3][0], p[2][1], p[1][2], p[0][3], superXBRWeight1)
+			c := blendByVariation(c1, c2, d1, d2)
+			grid[y*w+x] = antiRinging(c, p[1][1], p[2][1], p[1][2], p[2][2])
+			lumas[y*w+x] = grid[y*w+x].luma()
+		}
+	}
+
+	// pass 2: odd / even and even / odd
+	for y := 0; y < h; y++ {
+		for x := 1 - (y & 1); x < w; x += 2 {
+			var dh, dv float32
+			for k := -2; k <= 2; k += 2 {
+				for m := -3; m < 3; m += 2 {
+					dh += abs(lumaAt(x+m, y+k) - lumaAt(x+m+2, y+k))
+					dv += abs(lumaAt(x+k, y+m) - lumaAt(x+k, y+m+2))
+				}
+			}
+
+			left, right := at(x-1, y), at(x+1, y)
+			up, down := at(x, y-1), at(x, y+1)
+			ch := filter4(at(x-3, y), left, right, at(x+3, y), superXBRWeight2)
+			cv := filter4(at(x, y-3), up, down, at(x, y+3), superXBRWeight2)
+			c := blendByVariation(ch, cv, dh, dv)
+			grid[y*w+x] = antiRinging(c, left, right, up, down)
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := grid[y*w+x]
+			setPixel(dst, x, y, uint32(toByte(c.r))<<16|uint32(toByte(c.g))<<8|uint32(toByte(c.b)))
+		}
+	}
+}
+
+func abs(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func toByte(v float32) byte {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return byte(v + 0.5)
+}
+
+// filter4 interpolates the middle of b and c with a 4-tap filter.
+func filter4(a, b, c, d rgbf, wgt float32) rgbf {
+	w1 := -wgt
+	w2 := wgt + 0.5
+	return rgbf{
+		w1*(a.r+d.r) + w2*(b.r+c.r),
+		w1*(a.g+d.g) + w2*(b.g+c.g),
+		w1*(a.b+d.b) + w2*(b.b+c.b),
+	}
+}
+
+// blendByVariation prefers the interpolation along the direction with the
+// least variation (the direction of the edge).
+func blendByVariation(c1, c2 rgbf, d1, d2 float32) rgbf {
+	d1 *= d1
+	d2 *= d2
+	if d1+d2 == 0 {
+		return rgbf{(c1.r + c2.r) / 2, (c1.g + c2.g) / 2, (c1.b + c2.b) / 2}
+	}
+	w := d2 / (d1 + d2)
+	return rgbf{
+		c1.r*w + c2.r*(1-w),
+		c1.g*w + c2.g*(1-w),
+		c1.b*w + c2.b*(1-w),
+	}
+}
+
+func antiRinging(c, a, b, d, e rgbf) rgbf {
+	clamp := func(v, p, q, r, s float32) float32 {
+		min := float32(math.Min(math.Min(float64(p), float64(q)), math.Min(float64(r), float64(s))))
+		max := float32(math.Max(math.Max(float64(p), float64(q)), math.Max(float64(r), float64(s))))
+		if v < min {
+			return min
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+	return rgbf{
+		clamp(c.r, a.r, b.r, d.r, e.r),
+		clamp(c.g, a.g, b.g, d.g, e.g),
+		clamp(c.b, a.b, b.b, d.b, e.b),
+	}
+}
@@ -0,0 +1,164 @@
+// ORIGINAL
+
+// Package video post-processes the frames of chibines.Console (or of
+// chibines.NTSCFilter): overscan cropping, pixel art scalers (Scale2x, xBR,
+// super-xBR) and scanline / CRT overlays. The same Renderer can be used for
+// the screen, screenshots and video capture.
+//
+//	renderer := video.NewRenderer()
+//	renderer.SetFilter("xbr4x")
+//	renderer.SetOverlay("scanlines")
+//	img := renderer.Render(console.Buffer())
+package video
+
+import (
+	"fmt"
+	"image"
+)
+
+// Filter is a pixel art scaler.
+type Filter interface {
+	Name() string
+	Scale() int
+	apply(dst *image.RGBA, src *source)
+}
+
+// newFilters returns new instances of all filters (filters keep work buffers).
+func newFilters() []Filter {
+	return []Filter{
+		noneFilter{},
+		&scaleXFilter{scale: 2},
+		&scaleXFilter{scale: 3},
+		&scaleXFilter{scale: 4},
+		&xbrFilter{scale: 2},
+		&xbrFilter{scale: 3},
+		&xbrFilter{scale: 4},
+		&superXBRFilter{scale: 2},
+		&superXBRFilter{scale: 4},
+	}
+}
+
+// Filters returns the names of all filters.
+func Filters() []string {
+	filters := newFilters()
+	names := make([]string, len(filters))
+	for i, f := range filters {
+		names[i] = f.Name()
+	}
+	return names
+}
+
+// FindFilter returns a new filter with the given name.
+func FindFilter(name string) (Filter, error) {
+	for _, f := range newFilters() {
+		if f.Name() == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown video filter: %s", name)
+}
+
+type noneFilter struct{}
+
+func (noneFilter) Name() string {
+	return "none"
+}
+
+func (noneFilter) Scale() int {
+	return 1
+}
+
+func (noneFilter) apply(dst *image.RGBA, src *source) {
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			setPixel(dst, x, y, src.pixel(x, y))
+		}
+	}
+}
+
+// Renderer crops a frame and applies a filter and an overlay. Render reuses
+// its output image, so it must not be used from several goroutines.
+type Renderer struct {
+	crop    Crop
+	filter  Filter
+	overlay Overlay
+	src     source
+	dst     *image.RGBA
+}
+
+func NewRenderer() *Renderer {
+	return &Renderer{
+		filter:  noneFilter{},
+		overlay: noneOverlay{},
+	}
+}
+
+func (r *Renderer) SetFilter(name string) error {
+	f, err := FindFilter(name)
+	if err != nil {
+		return err
+	}
+	r.filter = f
+	return nil
+}
+
+func (r *Renderer) Filter() string {
+	return r.filter.Name()
+}
+
+func (r *Renderer) SetOverlay(name string) error {
+	o, err := FindOverlay(name)
+	if err != nil {
+		return err
+	}
+	r.overlay = o
+	return nil
+}
+
+func (r *Renderer) Overlay() string {
+	return r.overlay.Name()
+}
+
+// SetCrop sets the overscan hidden on each edge. An invalid crop (negative
+// or hiding the whole screen) is ignored.
+func (r *Renderer) SetCrop(crop Crop) {
+	if crop.valid() {
+		r.crop = crop
+	}
+}
+
+func (r *Renderer) Crop() Crop {
+	return r.crop
+}
+
+// Scale returns the scale factor of the current filter.
+func (r *Renderer) Scale() int {
+	return r.filter.Scale()
+}
+
+// Render returns src cropped, scaled by the filter and with the overlay
+// applied. The returned image is reused by the next call.
+func (r *Renderer) Render(src *image.RGBA) *image.RGBA {
+	r.src.load(r.crop.Apply(src))
+
+	scale := r.filter.Scale()
+	rect := image.Rect(0, 0, r.src.width*scale, r.src.height*scale)
+	if r.dst == nil || r.dst.Rect != rect {
+		r.dst = image.NewRGBA(rect)
+	}
+
+	r.filter.apply(r.dst, &r.src)
+	r.overlay.apply(r.dst, scale)
+	return r.dst
+}
+
+// Next returns the name after current in names (wrapping around), for
+// cycling filters or overlays with a hotkey.
+func Next(names []string, current string) string {
+	for i, name := range names {
+		if name == current {
+			return names[(i+1)%len(names)]
+		}
+	}
+	return names[0]
+}
@@ -0,0 +1,216 @@
+// refs: https://github.com/FFmpeg/FFmpeg/blob/master/libavfilter/vf_xbr.c
+package video
+
+import "image"
+
+// xBR (scale by rules, level 2) by Hyllian
+//
+// Each source pixel E becomes a block of scale x scale pixels. Its four
+// corners are processed in turn (bottom-right, top-right, top-left,
+// bottom-left) in a frame rotated so that the corner is bottom-right: the
+// weighted color distances along both diagonals of the 5x5 neighborhood
+// decide whether an edge cuts the corner, and whether it is shallow (left),
+// steep (up) or diagonal. The pixels of the block on the far side of the
+// edge are then blended with F or H, with the rules of each scale.
+type xbrFilter struct {
+	scale int
+	block []uint32
+}
+
+func (f *xbrFilter) Name() string {
+	switch f.scale {
+	case 3:
+		return "xbr3x"
+	case 4:
+		return "xbr4x"
+	}
+	return "xbr2x"
+}
+
+func (f *xbrFilter) Scale() int {
+	return f.scale
+}
+
+// colors closer than this are equal for the edge rules
+const xbrEqualThreshold = 155
+
+func (f *xbrFilter) apply(dst *image.RGBA, src *source) {
+	n := f.scale
+	if len(f.block) != n*n {
+		f.block = make([]uint32, n*n)
+	}
+
+	for y := 0; y < src.height; y++ {
+		for x := 0; x < src.width; x++ {
+			e := src.pixel(x, y)
+			for i := range f.block {
+				f.block[i] = e
+			}
+			for _, r := range [4]int{0, 3, 2, 1} {
+				f.corner(src, x, y, r)
+			}
+			for sy := 0; sy < n; sy++ {
+				for sx := 0; sx < n; sx++ {
+					setPixel(dst, x*n+sx, y*n+sy, f.block[sy*n+sx])
+				}
+			}
+		}
+	}
+}
+
+// corner applies the rules to the bottom-right corner of the block in the
+// frame rotated by r:
+//
+//	   A1 B1 C1
+//	A0 A  B  C  C4
+//	D0 D  E  F  F4
+//	G0 G  H  I  I4
+//	   G5 H5 I5
+func (f *xbrFilter) corner(src *source, x, y int, r int) {
+	pixelAt := func(dx, dy int) uint32 {
+		rx, ry := rotate(dx, dy, r)
+		return src.pixel(x+rx, y+ry)
+	}
+	at := func(dx, dy int) yuv {
+		rx, ry := rotate(dx, dy, r)
+		return src.yuv(x+rx, y+ry)
+	}
+
+	pe := pixelAt(0, 0)
+	pf := pixelAt(1, 0)
+	ph := pixelAt(0, 1)
+	if pe == ph || pe == pf {
+		return
+	}
+
+	b := at(0, -1)
+	c := at(1, -1)
+	d := at(-1, 0)
+	e := at(0, 0)
+	fv := at(1, 0)
+	g := at(-1, 1)
+	h := at(0, 1)
+	i := at(1, 1)
+	f4 := at(2, 0)
+	i4 := at(2, 1)
+	h5 := at(0, 2)
+	i5 := at(1, 2)
+
+	// weighted distances across the two diagonals
+	de := distance(e, c) + distance(e, g) + distance(i, h5) + distance(i, f4) + 4*distance(h, fv)
+	di := distance(h, d) + distance(h, i5) + distance(fv, i4) + distance(fv, b) + 4*distance(e, i)
+	if de > di {
+		return
+	}
+
+	px := ph
+	if distance(e, fv) <= distance(e, h) {
+		px = pf
+	}
+
+	// index of the pixel sx, sy of the rotated block
+	n := f.scale
+	index := func(sx, sy int) int {
+		rx, ry := rotate(2*sx-(n-1), 2*sy-(n-1), r)
+		return (ry+n-1)/2*n + (rx+n-1)/2
+	}
+	// blend pixel k (row by row in the rotated block) with px
+	blend := func(k int, w int32) {
+		p := &f.block[index(k%n, k/n)]
+		*p = mix(*p, px, w)
+	}
+	set := func(k int, v uint32) {
+		f.block[index(k%n, k/n)] = v
+	}
+	get := func(k int) uint32 {
+		return f.block[index(k%n, k/n)]
+	}
+
+	equal := func(a, b yuv) bool {
+		return distance(a, b) < xbrEqualThreshold
+	}
+	if !(de < di && (!equal(fv, b) && !equal(h, d) ||
+		equal(e, i) && !equal(fv, i4) && !equal(h, i5) ||
+		equal(e, g) || equal(e, c))) {
+		blend(n*n-1, 128)
+		return
+	}
+
+	ke := distance(fv, g)
+	ki := distance(h, c)
+	pg := pixelAt(-1, 1)
+	pc := pixelAt(1, -1)
+	left := ke*2 <= ki && pe != pg && pixelAt(-1, 0) != pg
+	up := ke >= ki*2 && pe != pc && pixelAt(0, -1) != pc
+
+	switch n {
+	case 2:
+		switch {
+		case left && up:
+			blend(3, 224)
+			blend(2, 64)
+			set(1, get(2))
+		case left:
+			blend(3, 192)
+			blend(2, 64)
+		case up:
+			blend(3, 192)
+			blend(1, 64)
+		default:
+			blend(3, 128)
+		}
+	case 3:
+		switch {
+		case left && up:
+			blend(7, 192)
+			blend(6, 64)
+			set(5, get(7))
+			set(2, get(6))
+			set(8, px)
+		case left:
+			blend(7, 192)
+			blend(5, 64)
+			blend(6, 64)
+			set(8, px)
+		case up:
+			blend(5, 192)
+			blend(7, 64)
+			blend(2, 64)
+			set(8, px)
+		default:
+			blend(8, 224)
+			blend(5, 32)
+			blend(7, 32)
+		}
+	case 4:
+		switch {
+		case left && up:
+			blend(13, 192)
+			blend(12, 64)
+			set(15, px)
+			set(14, px)
+			set(11, px)
+			set(10, get(12))
+			set(3, get(12))
+			set(7, get(13))
+		case left:
+			blend(11, 192)
+			blend(13, 192)
+			blend(10, 64)
+			blend(12, 64)
+			set(14, px)
+			set(15, px)
+		case up:
+			blend(14, 192)
+			blend(7, 192)
+			blend(10, 64)
+			blend(3, 64)
+			set(11, px)
+			set(15, px)
+		default:
+			blend(11, 128)
+			blend(14, 128)
+			set(15, px)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// ORIGINAL
+package chibines
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// RIFF WAVE (PCM only)
+// http://soundfile.sapp.org/doc/WaveFormat/
+const wavFormatPCM = 1
+
+type wavHeader struct {
+	ChunkID       [4]byte
+	ChunkSize     uint32
+	Format        [4]byte
+	Subchunk1ID   [4]byte
+	Subchunk1Size uint32
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	Subchunk2ID   [4]byte
+	Subchunk2Size uint32
+}
+
+func newWAVHeader(sampleRate, channels, bitsPerSample int, dataSize uint32) *wavHeader {
+	blockAlign := channels * bitsPerSample / 8
+	return &wavHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     36 + dataSize,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   wavFormatPCM,
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: uint16(bitsPerSample),
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: dataSize,
+	}
+}
+
+func (h *wavHeader) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, h)
+	return buf.Bytes()
+}
+
+// WAVWriter writes a 16-bit PCM WAV file (mono or interleaved stereo) as
+// the samples come (e.g. from Console.SetAudioRecorder). The sizes are
+// written by Close.
+type WAVWriter struct {
+	file       *os.File
+	w          *bufio.Writer
+	sampleRate int
+	channels   int
+	dataSize   uint32
+	buf        []byte
+}
+
+func NewWAVWriter(path string, sampleRate int, channels int) (*WAVWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WAVWriter{
+		file:       file,
+		w:          bufio.NewWriter(file),
+		sampleRate: sampleRate,
+		channels:   channels,
+	}
+	// the sizes are written by Close
+	if _, err := w.w.Write(w.header()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WAVWriter) header() []byte {
+	return newWAVHeader(w.sampleRate, w.channels, 16, w.dataSize).Bytes()
+}
+
+// WriteSamples writes samples (-1.0 - 1.0), interleaved when there are
+// several channels.
+func (w *WAVWriter) WriteSamples(samples []float32) error {
+	w.buf = AppendPCM16(w.buf[:0], samples)
+	w.dataSize += uint32(len(w.buf))
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *WAVWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if _, err := w.file.WriteAt(w.header(), 0); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// AppendPCM16 appends samples (-1.0 - 1.0) as 16-bit little endian PCM.
+func AppendPCM16(buf []byte, samples []float32) []byte {
+	for _, s := range samples {
+		v := int32(s * 32767)
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		buf = append(buf, byte(v), byte(v>>8))
+	}
+	return buf
+}
+
+// wavData is a decoded PCM WAV file. Samples are normalized to -1.0 - 1.0
+// and interleaved.
+type wavData struct {
+	SampleRate int
+	Channels   int
+	Samples    []float32
+}
+
+func decodeWAV(data []byte) (*wavData, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("invalid .wav file")
+	}
+
+	var audioFormat, channels, bitsPerSample uint16
+	var sampleRate uint32
+	var pcm []byte
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if pos+size > len(data) {
+			size = len(data) - pos
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("invalid .wav file: broken fmt chunk")
+			}
+			audioFormat = binary.LittleEndian.Uint16(data[pos:])
+			channels = binary.LittleEndian.Uint16(data[pos+2:])
+			sampleRate = binary.LittleEndian.Uint32(data[pos+4:])
+			bitsPerSample = binary.LittleEndian.Uint16(data[pos+14:])
+		case "data":
+			pcm = data[pos : pos+size]
+		}
+		// chunks are word aligned
+		pos += size + (size & 1)
+	}
+
+	if audioFormat != wavFormatPCM || channels == 0 || sampleRate == 0 || pcm == nil {
+		return nil, errors.New("unsupported .wav file: PCM only")
+	}
+
+	wav := &wavData{
+		SampleRate: int(sampleRate),
+		Channels:   int(channels),
+	}
+	switch bitsPerSample {
+	case 8:
+		wav.Samples = make([]float32, len(pcm))
+		for i, v := range pcm {
+			wav.Samples[i] = (float32(v) - 128) / 128
+		}
+	case 16:
+		wav.Samples = make([]float32, len(pcm)/2)
+		for i := range wav.Samples {
+			wav.Samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768
+		}
+	default:
+		return nil, errors.New("unsupported .wav file: 8 or 16 bits per sample only")
+	}
+
+	return wav, nil
+}
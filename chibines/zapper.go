@@ -0,0 +1,89 @@
+// refs: github.com/libretro/Mesen
+package chibines
+
+// Zapper light gun
+// https://www.nesdev.org/wiki/Zapper
+const (
+	// pixels around the aimed pixel checked for light
+	zapperDetectionRadius = 3
+	// the photodiode keeps reporting light for about 20 scanlines after the beam passed
+	zapperLightScanLines = 20
+	// R+G+B of a pixel that is bright enough to be seen by the photodiode
+	zapperBrightnessThreshold = 85
+)
+
+type Zapper struct {
+	ppu *PPU
+
+	x       int
+	y       int
+	trigger bool
+}
+
+func NewZapper(ppu *PPU) *Zapper {
+	return &Zapper{
+		ppu: ppu,
+		x:   -1,
+		y:   -1,
+	}
+}
+
+// SetState sets the aimed pixel (x: 0-255, y: 0-239) and the trigger.
+// Negative coordinates mean that the gun is pointed away from the screen.
+func (z *Zapper) SetState(x, y int, trigger bool) {
+	z.x = x
+	z.y = y
+	z.trigger = trigger
+}
+
+// Read returns D3 (0 = light detected) and D4 (1 = trigger pulled).
+func (z *Zapper) Read(address uint16) byte {
+	value := byte(0)
+	if !z.IsLightFound() {
+		value |= 0x08
+	}
+	if z.trigger {
+		value |= 0x10
+	}
+	return value
+}
+
+func (z *Zapper) Write(value byte) {
+	// NOTHING DONE
+	// the zapper does not use the strobe
+}
+
+func (z *Zapper) UpdateFrame() {
+}
+
+// IsLightFound reports whether a bright pixel near the aimed position was
+// drawn by the PPU within the last few scanlines.
+func (z *Zapper) IsLightFound() bool {
+	if z.x < 0 || z.y < 0 {
+		return false
+	}
+
+	scanLine := z.ppu.ScanLine
+	cycle := int(z.ppu.Cycle)
+	for yOffset := -zapperDetectionRadius; yOffset <= zapperDetectionRadius; yOffset++ {
+		yPos := z.y + yOffset
+		if yPos < 0 || yPos >= 240 {
+			continue
+		}
+		for xOffset := -zapperDetectionRadius; xOffset <= zapperDetectionRadius; xOffset++ {
+			xPos := z.x + xOffset
+			if xPos < 0 || xPos >= 256 {
+				continue
+			}
+
+			// the pixel must already be drawn in the current frame
+			if scanLine >= yPos && (scanLine-yPos) <= zapperLightScanLines && (scanLine != yPos || cycle > xPos) {
+				if z.ppu.PixelBrightness(xPos, yPos) >= zapperBrightnessThreshold {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
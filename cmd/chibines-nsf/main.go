@@ -6,7 +6,9 @@ import (
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/gordonklaus/portaudio"
@@ -53,9 +55,22 @@ var NoteNames = []string{
 
 var window *gui.MasterWindow
 var nsfPlayer *chibines.NSFPlayer
+var nsfPath string
+var playlist *chibines.NSFPlaylist
 var audioForConsole *audio.Audio
 var isRunning bool = false
 var nsfInfoForView *NSFInfoForView
+var audioQuality chibines.AudioQuality
+var mixMode chibines.APUMixMode
+
+var audioQualityName = flag.String("audio-quality", chibines.AudioQualityHigh.String(), "audio quality: low (fast, aliasing), medium, high (band-limited synthesis)")
+var audioPanning = flag.String("panning", "mono", "stereo panning preset: "+strings.Join(chibines.PanningPresets(), ", ")+" (mono = mono output)")
+var audioMixMode = flag.String("mix", chibines.MixNonlinear.String(), "channel mixing: nonlinear (like the NES), linear")
+var songLength = flag.Duration("length", 0, "length of the songs without NSFe or playlist length, e.g. 2m30s (0 = until they loop, or forever)")
+var songFade = flag.Duration("fade", 8*time.Second, "fade-out of the songs without NSFe or playlist fade")
+var songLoops = flag.Int("loops", 2, "end the songs without length after their loop is played this many times (0 = no loop detection)")
+var songSilence = flag.Duration("silence", 3*time.Second, "go to the next song after this much silence (0 = never)")
+var vgmFile = flag.String("vgm", "", "log the APU register writes of the NSF given on the command line to this file (.vgm, or .vgz gzip-compressed)")
 
 func NoteFromFreq(freq float64) float64 {
 	return 12.0 * math.Log2(freq/FreqC0)
@@ -83,30 +98,49 @@ func StartAudio() {
 	// initialize audio
 	portaudio.Initialize()
 
-	audioForConsole = audio.NewAudio()
-	if err := audioForConsole.Start(); err != nil {
-		log.Fatalln(err)
-	}
-
 	if nsfPlayer.Console == nil {
 		log.Fatalln("console must be set")
 	}
 
-	nsfPlayer.Console.SetAudioChannel(audioForConsole.Channel)
+	// the output format is read by the audio callback: set it before the
+	// stream starts
+	nsfPlayer.Console.SetAudioQuality(audioQuality)
+	nsfPlayer.Console.APU.SetPanningPreset(*audioPanning)
+	nsfPlayer.Console.SetAudioStereo(*audioPanning != "mono")
+	nsfPlayer.Console.APU.SetMixMode(mixMode)
+	nsfPlayer.Console.APU.SetScopeSize(scopeSize)
+
+	audioForConsole = audio.NewAudio(nsfPlayer.Console)
+	if err := audioForConsole.Start(); err != nil {
+		log.Fatalln(err)
+	}
+
 	nsfPlayer.Console.SetAudioSampleRate(audioForConsole.SampleRate)
+	// keep about 80ms in the audio buffer
+	target := audioForConsole.SampleRate * 0.08 * float64(nsfPlayer.Console.AudioChannels())
+	nsfPlayer.Console.SetAudioRateControl(int(target), 0.005)
+}
+
+func validPanningPreset(name string) bool {
+	for _, preset := range chibines.PanningPresets() {
+		if preset == name {
+			return true
+		}
+	}
+	return false
 }
 
 func StopAudio() {
 	if isRunning {
 		audioForConsole.Stop()
 		nsfPlayer.Console.SetAudioSampleRate(0)
-		nsfPlayer.Console.SetAudioChannel(nil)
 
 		portaudio.Terminate()
 	}
 }
 
 func ResetNSFPlayer(file_name string) {
+	stopVGMLog()
 	StopAudio()
 	isRunning = false
 
@@ -117,6 +151,11 @@ func ResetNSFPlayer(file_name string) {
 	if err != nil {
 		log.Fatalln(err)
 	}
+	nsfPath = file_name
+	nsfPlayer.DefaultSongLen = *songLength
+	nsfPlayer.DefaultSongFadeLen = *songFade
+	nsfPlayer.LoopCount = *songLoops
+	nsfPlayer.SilenceLen = *songSilence
 	log.Printf("TotalSongs: %d\n", nsfPlayer.NSFFileInfo.TotalSongs)
 	log.Printf("SongName: %s\n", nsfPlayer.NSFFileInfo.SongName)
 	log.Printf("ArtistName: %s\n", nsfPlayer.NSFFileInfo.ArtistName)
@@ -133,11 +172,67 @@ func ResetNSFPlayer(file_name string) {
 	StartAudio()
 }
 
+// openFile plays an NSF / NSFe file, or an .m3u playlist.
+func openFile(path string) {
+	if strings.EqualFold(filepath.Ext(path), ".m3u") {
+		var err error
+		playlist, err = chibines.LoadNSFPlaylist(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Playlist: %s (%d songs)\n", path, len(playlist.Entries))
+		playEntry(playlist.Next)
+		return
+	}
+
+	ResetNSFPlayer(path)
+	playlist = chibines.NewNSFPlaylist(path, nsfPlayer.NSFFileInfo)
+	playEntry(playlist.Next)
+}
+
+// playEntry starts the current song of the playlist, after loading its NSF
+// file if needed. It keeps playing if the previous song was playing. An
+// entry whose song is not in its file is skipped with skip (playlist.Next
+// or playlist.Prev).
+func playEntry(skip func() chibines.NSFPlaylistEntry) {
+	for i := 0; i < len(playlist.Entries); i++ {
+		entry := playlist.Entry()
+		if nsfPlayer == nil || entry.Path != nsfPath {
+			playing := nsfPlayer != nil && nsfPlayer.PlayState
+			ResetNSFPlayer(entry.Path)
+			nsfPlayer.PlayState = playing
+		}
+		if entry.Song < nsfPlayer.NSFFileInfo.TotalSongs {
+			nsfPlayer.SetSong(entry.Song)
+			nsfPlayer.SetSongLength(entry.Length, entry.Fade)
+			return
+		}
+		log.Printf("Playlist: no song %d in %s (%d songs), skipped\n", int(entry.Song)+1, entry.Path, nsfPlayer.NSFFileInfo.TotalSongs)
+		skip()
+	}
+	log.Fatalln("Playlist: no song to play")
+}
+
 func onDrop(names []string) {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("%s", names[0]))
 	dropInFiles := sb.String()
-	ResetNSFPlayer(dropInFiles)
+	openFile(dropInFiles)
+}
+
+// songTime returns the elapsed time, and the length of the song with its
+// fade when it is known.
+func songTime() string {
+	elapsed := formatTime(nsfPlayer.Elapsed())
+	if nsfPlayer.CurrentSongLen <= 0 {
+		return elapsed
+	}
+	return elapsed + " / " + formatTime(nsfPlayer.CurrentSongLen+nsfPlayer.CurrentSongFadeLen)
+}
+
+func formatTime(d time.Duration) string {
+	seconds := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
 }
 
 func renderNSFPlayerGUI() {
@@ -150,7 +245,7 @@ func renderNSFPlayerGUI() {
 	imgui.Text(nsfInfoForView.title)
 	imgui.Text(nsfInfoForView.artist)
 	imgui.Text(nsfInfoForView.copyright)
-	trackAndState := fmt.Sprintf("%-9s : %02d", "No", nsfPlayer.CurrentSong+1)
+	trackAndState := fmt.Sprintf("%-9s : %02d [%s] %s", "No", nsfPlayer.CurrentSong+1, songTime(), playlist.Entry().Title)
 	imgui.Text(trackAndState)
 
 	dl := imgui.WindowDrawList()
@@ -158,47 +253,19 @@ func renderNSFPlayerGUI() {
 	imgui.PushFont(window.FontsData[2])
 	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 20})
 
-	pos = imgui.CursorPos()
-	freq := nsfPlayer.Console.APU.CurrentInfo()
-
-	// Draw Visualizer (Keyboard & Noize & DMC)
-	s1 := Freq2NoteString(freq.Square1)
-	square1Text := fmt.Sprintf("Square 1: %s", s1)
-	imgui.Text(square1Text)
-	var s1KeyIndex int = -1
-	if s1 != "" {
-		s1KeyIndex = Pitch2KeyIndexTable[s1]
-	}
-	DrawPianoKeyboard(&dl, imgui.Vec2{X: pos.X + 0, Y: pos.Y + 25}, s1KeyIndex)
-	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 80})
-
-	pos = imgui.CursorPos()
-	s2 := Freq2NoteString(freq.Square2)
-	square2Text := fmt.Sprintf("Square 2: %s", s2)
-	var s2KeyIndex int = -1
-	if s2 != "" {
-		s2KeyIndex = Pitch2KeyIndexTable[s2]
-	}
-	imgui.Text(square2Text)
-	DrawPianoKeyboard(&dl, imgui.Vec2{X: pos.X + 0, Y: pos.Y + 25}, s2KeyIndex)
-	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 80})
-
-	pos = imgui.CursorPos()
-	t := Freq2NoteString(freq.Triangle)
-	triangleText := fmt.Sprintf("Triangle: %s", t)
-	var triangleKeyIndex int = -1
-	if t != "" {
-		triangleKeyIndex = Pitch2KeyIndexTable[t]
+	apu := nsfPlayer.Console.APU
+	freq := apu.CurrentInfo()
+
+	// Draw Visualizer (Keyboard & Noize & DMC, Oscilloscope or Spectrum)
+	switch visualizer {
+	case visualizerScope:
+		renderScopeVisualizer(&dl, apu, freq)
+	case visualizerSpectrum:
+		renderSpectrumVisualizer(&dl, apu, audioForConsole.SampleRate)
+	default:
+		renderKeyboardVisualizer(&dl, apu, freq)
 	}
-	imgui.Text(triangleText)
-	DrawPianoKeyboard(&dl, imgui.Vec2{X: pos.X + 0, Y: pos.Y + 25}, triangleKeyIndex)
-	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 80})
-
-	pos = imgui.CursorPos()
-	noiseText := fmt.Sprintf("Noise: Volume = %X Period = %d", freq.Noise.Out, freq.Noise.Period)
-	imgui.Text(noiseText)
-	dmcText := fmt.Sprintf("DMC  : Volume = %X Period = %d", freq.DMC.Out, freq.DMC.Period)
-	imgui.Text(dmcText)
+	imgui.Text("Mute = 1-5 | Solo = Shift+1-5 | Reset = 0 | View = V")
 
 	// Status Line (Play Status & Help Text)
 	pos = imgui.CursorPos()
@@ -232,6 +299,49 @@ func renderNSFPlayerGUI() {
 	imgui.PopFont()
 }
 
+// renderKeyboardVisualizer draws the notes of the square and triangle
+// channels on keyboards, and the volume and period of the noise and DMC.
+func renderKeyboardVisualizer(dl *imgui.DrawList, apu *chibines.APU, freq *chibines.APUCurrentInfo) {
+	pos := imgui.CursorPos()
+	s1 := Freq2NoteString(freq.Square1)
+	square1Text := fmt.Sprintf("Square 1: %s%s", s1, mixerState(apu, chibines.ChannelSquare1))
+	imgui.Text(square1Text)
+	var s1KeyIndex int = -1
+	if s1 != "" {
+		s1KeyIndex = Pitch2KeyIndexTable[s1]
+	}
+	DrawPianoKeyboard(dl, imgui.Vec2{X: pos.X + 0, Y: pos.Y + 25}, s1KeyIndex)
+	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 80})
+
+	pos = imgui.CursorPos()
+	s2 := Freq2NoteString(freq.Square2)
+	square2Text := fmt.Sprintf("Square 2: %s%s", s2, mixerState(apu, chibines.ChannelSquare2))
+	var s2KeyIndex int = -1
+	if s2 != "" {
+		s2KeyIndex = Pitch2KeyIndexTable[s2]
+	}
+	imgui.Text(square2Text)
+	DrawPianoKeyboard(dl, imgui.Vec2{X: pos.X + 0, Y: pos.Y + 25}, s2KeyIndex)
+	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 80})
+
+	pos = imgui.CursorPos()
+	t := Freq2NoteString(freq.Triangle)
+	triangleText := fmt.Sprintf("Triangle: %s%s", t, mixerState(apu, chibines.ChannelTriangle))
+	var triangleKeyIndex int = -1
+	if t != "" {
+		triangleKeyIndex = Pitch2KeyIndexTable[t]
+	}
+	imgui.Text(triangleText)
+	DrawPianoKeyboard(dl, imgui.Vec2{X: pos.X + 0, Y: pos.Y + 25}, triangleKeyIndex)
+	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + 80})
+
+	pos = imgui.CursorPos()
+	noiseText := fmt.Sprintf("Noise: Volume = %X Period = %d%s", freq.Noise.Out, freq.Noise.Period, mixerState(apu, chibines.ChannelNoise))
+	imgui.Text(noiseText)
+	dmcText := fmt.Sprintf("DMC  : Volume = %X Period = %d%s", freq.DMC.Out, freq.DMC.Period, mixerState(apu, chibines.ChannelDMC))
+	imgui.Text(dmcText)
+}
+
 func renderGUI(w *gui.MasterWindow) {
 	w.Platform.NewFrame()
 	imgui.NewFrame()
@@ -239,7 +349,7 @@ func renderGUI(w *gui.MasterWindow) {
 	if isRunning {
 		renderNSFPlayerGUI()
 	} else {
-		var msg string = "ChibiNES NSF Player is currently stopped.\n\nPlease drag and drop NSF file."
+		var msg string = "ChibiNES NSF Player is currently stopped.\n\nPlease drag and drop NSF file or .m3u playlist."
 		textSize := imgui.CalcTextSize(msg, false, 0)
 		xpos := (float32(WINDOW_WIDTH) - textSize.X) / 2
 		ypos := (float32(WINDOW_HEIGHT) - textSize.Y) / 2
@@ -260,15 +370,31 @@ func renderGUI(w *gui.MasterWindow) {
 
 func main() {
 	flag.Parse()
+	var err error
+	audioQuality, err = chibines.ParseAudioQuality(*audioQualityName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if !validPanningPreset(*audioPanning) {
+		log.Fatalf("unknown panning preset: %s\n", *audioPanning)
+	}
+	mixMode, err = chibines.ParseAPUMixMode(*audioMixMode)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	if len(flag.Args()) >= 1 {
 		_, err := os.Stat(flag.Arg(0))
 		if err != nil {
 			log.Fatalln("no NSF file specified or found")
 		}
 
-		ResetNSFPlayer(flag.Arg(0))
+		openFile(flag.Arg(0))
+		if *vgmFile != "" {
+			startVGMLog(*vgmFile)
+		}
 	}
 	defer StopAudio()
+	defer stopVGMLog()
 
 	window = gui.NewMasterWindow("ChibiNES NSF Player", WINDOW_WIDTH, WINDOW_HEIGHT, 0)
 	window.SetDropCallback(onDrop)
@@ -288,6 +414,7 @@ func main() {
 		int(glfw.KeyRight): false,
 		int(glfw.KeyLeft):  false,
 		int(glfw.KeyEnter): false,
+		int(glfw.KeyV):     false,
 	}
 
 	glfwWindow := window.Platform.Window
@@ -298,14 +425,16 @@ func main() {
 
 		if !previousKeyState[int(glfw.KeyRight)] && glfwWindow.GetKey(glfw.KeyRight) == glfw.Press {
 			previousKeyState[int(glfw.KeyRight)] = true
-			nsfPlayer.NextSong()
+			playlist.Next()
+			playEntry(playlist.Next)
 		}
 		if previousKeyState[int(glfw.KeyRight)] && glfwWindow.GetKey(glfw.KeyRight) == glfw.Release {
 			previousKeyState[int(glfw.KeyRight)] = false
 		}
 		if !previousKeyState[int(glfw.KeyLeft)] && glfwWindow.GetKey(glfw.KeyLeft) == glfw.Press {
 			previousKeyState[int(glfw.KeyLeft)] = true
-			nsfPlayer.PrevSong()
+			playlist.Prev()
+			playEntry(playlist.Prev)
 		}
 		if previousKeyState[int(glfw.KeyLeft)] && glfwWindow.GetKey(glfw.KeyLeft) == glfw.Release {
 			previousKeyState[int(glfw.KeyLeft)] = false
@@ -317,12 +446,27 @@ func main() {
 		if previousKeyState[int(glfw.KeyEnter)] && glfwWindow.GetKey(glfw.KeyEnter) == glfw.Release {
 			previousKeyState[int(glfw.KeyEnter)] = false
 		}
+		if !previousKeyState[int(glfw.KeyV)] && glfwWindow.GetKey(glfw.KeyV) == glfw.Press {
+			previousKeyState[int(glfw.KeyV)] = true
+			nextVisualizer()
+		}
+		if previousKeyState[int(glfw.KeyV)] && glfwWindow.GetKey(glfw.KeyV) == glfw.Release {
+			previousKeyState[int(glfw.KeyV)] = false
+		}
+
+		if isRunning {
+			processInputMixer(glfwWindow, nsfPlayer.Console.APU)
+		}
 
 		dt := cur_timestamp - prev_timestamp
 		prev_timestamp = cur_timestamp
 
 		if isRunning && nsfPlayer.PlayState {
 			nsfPlayer.StepSeconds(dt)
+			if nsfPlayer.Ended() {
+				playlist.Next()
+				playEntry(playlist.Next)
+			}
 		}
 
 		renderGUI(window)
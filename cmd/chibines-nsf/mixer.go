@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+// keys 1-5: mute, Shift + 1-5: solo, 0: reset
+var mixerKeys = [chibines.APUChannelCount]glfw.Key{glfw.Key1, glfw.Key2, glfw.Key3, glfw.Key4, glfw.Key5}
+
+const mixerResetKey = glfw.Key0
+
+var previousMixerKeyState = map[glfw.Key]bool{}
+
+func isMixerKeyTriggered(window *glfw.Window, key glfw.Key) bool {
+	pressed := window.GetKey(key) == glfw.Press
+	triggered := pressed && !previousMixerKeyState[key]
+	previousMixerKeyState[key] = pressed
+	return triggered
+}
+
+func processInputMixer(window *glfw.Window, apu *chibines.APU) {
+	shift := window.GetKey(glfw.KeyLeftShift) == glfw.Press || window.GetKey(glfw.KeyRightShift) == glfw.Press
+	for i, key := range mixerKeys {
+		if !isMixerKeyTriggered(window, key) {
+			continue
+		}
+		channel := chibines.APUChannel(i)
+		if shift {
+			apu.SetChannelSolo(channel, !apu.ChannelSolo(channel))
+		} else {
+			apu.SetChannelMute(channel, !apu.ChannelMute(channel))
+		}
+	}
+	if isMixerKeyTriggered(window, mixerResetKey) {
+		apu.ResetMixer()
+	}
+}
+
+// mixerState returns the mixer state of a channel for the visualizer.
+func mixerState(apu *chibines.APU, channel chibines.APUChannel) string {
+	switch {
+	case apu.ChannelSolo(channel):
+		return " [Solo]"
+	case apu.ChannelMute(channel):
+		return " [Mute]"
+	}
+	return ""
+}
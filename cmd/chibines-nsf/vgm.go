@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/kaishuu0123/chibines/chibines/vgm"
+)
+
+var vgmWriter *vgm.Writer
+
+// nsfString returns a string field of the NSF header (NUL-padded).
+func nsfString(field [32]byte) string {
+	return strings.TrimRight(string(field[:]), "\x00")
+}
+
+// startVGMLog logs the APU register writes of the player to path (.vgm or
+// .vgz) until stopVGMLog.
+func startVGMLog(path string) {
+	w, err := vgm.NewWriter(path)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	info := nsfPlayer.NSFFileInfo
+	w.SetTags(vgm.Tags{
+		Game:   nsfString(info.SongName),
+		Author: nsfString(info.ArtistName),
+		Notes:  nsfString(info.CopyrightHolder),
+	})
+	nsfPlayer.Console.SetAPURegisterLogger(w)
+	vgmWriter = w
+	log.Printf("VGM: started. Path: %s\n", path)
+}
+
+func stopVGMLog() {
+	if vgmWriter == nil {
+		return
+	}
+
+	nsfPlayer.Console.SetAPURegisterLogger(nil)
+	if err := vgmWriter.Close(); err != nil {
+		log.Println(err)
+	} else {
+		log.Printf("VGM: saved. Path: %s\n", vgmWriter.Path())
+	}
+	vgmWriter = nil
+}
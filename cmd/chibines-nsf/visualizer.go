@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/inkyblackness/imgui-go/v4"
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+// visualizers, switched with V
+const (
+	visualizerKeyboard = iota
+	visualizerScope
+	visualizerSpectrum
+	visualizerCount
+)
+
+var visualizer = visualizerKeyboard
+
+const (
+	// captured samples of each channel (about 85ms at 48kHz)
+	scopeSize = 4096
+	// samples shown by the oscilloscope (about 21ms at 48kHz, a period of A1)
+	scopeWindow = 1024
+	// samples of the FFT
+	spectrumSize    = 2048
+	spectrumBands   = 64
+	spectrumMinFreq = 40.0
+	spectrumMaxFreq = 16000.0
+	spectrumMinDB   = -80.0
+	spectrumFall    = 60.0 // dB per second
+)
+
+var waveformColor imgui.PackedColor = imgui.PackedColorFromVec4(imgui.Vec4{0.392, 0.584, 0.929, 1.0})
+var scopeBackgroundColor imgui.PackedColor = imgui.PackedColorFromVec4(imgui.Vec4{0.1, 0.1, 0.1, 1.0})
+var scopeTextColor imgui.PackedColor = imgui.PackedColorFromVec4(imgui.Vec4{0.6, 0.6, 0.6, 1.0})
+
+var scopeSamples = make([]float32, scopeWindow)
+var spectrumSamples = make([]float32, spectrumSize)
+var spectrumBins = make([]complex128, spectrumSize)
+var spectrumLevels = newSpectrumLevels()
+var spectrumTime float64
+
+// newSpectrumLevels returns the levels of silence (the bars rise from the
+// bottom).
+func newSpectrumLevels() []float64 {
+	levels := make([]float64, spectrumBands)
+	for i := range levels {
+		levels[i] = spectrumMinDB
+	}
+	return levels
+}
+
+func nextVisualizer() {
+	visualizer = (visualizer + 1) % visualizerCount
+}
+
+// renderScopeVisualizer draws the waveform of each channel.
+func renderScopeVisualizer(dl *imgui.DrawList, apu *chibines.APU, freq *chibines.APUCurrentInfo) {
+	scope := apu.Scope()
+	if scope == nil {
+		return
+	}
+
+	notes := [chibines.APUChannelCount]string{
+		Freq2NoteString(freq.Square1),
+		Freq2NoteString(freq.Square2),
+		Freq2NoteString(freq.Triangle),
+	}
+	width := imgui.WindowContentRegionWidth()
+	const height = 36
+
+	for i := chibines.APUChannel(0); i < chibines.APUChannelCount; i++ {
+		imgui.Text(fmt.Sprintf("%s: %s%s", i, notes[i], mixerState(apu, i)))
+		pos := imgui.CursorPos()
+		scope.ReadWaveform(i, scopeSamples)
+		drawWaveform(dl, pos, imgui.Vec2{X: width, Y: height}, scopeSamples)
+		imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + height + 4})
+	}
+}
+
+// drawWaveform draws samples (0-1) in a box, one point every 2 pixels.
+func drawWaveform(dl *imgui.DrawList, pos imgui.Vec2, size imgui.Vec2, samples []float32) {
+	dl.AddRectFilled(pos, imgui.Vec2{X: pos.X + size.X, Y: pos.Y + size.Y}, scopeBackgroundColor)
+
+	points := int(size.X / 2)
+	var prev imgui.Vec2
+	for i := 0; i < points; i++ {
+		v := samples[i*len(samples)/points]
+		p := imgui.Vec2{
+			X: pos.X + float32(i)*size.X/float32(points-1),
+			Y: pos.Y + (1-v)*(size.Y-2) + 1,
+		}
+		if i > 0 {
+			dl.AddLine(prev, p, waveformColor)
+		}
+		prev = p
+	}
+}
+
+// renderSpectrumVisualizer draws the spectrum of the mix, in bands spaced
+// logarithmically from spectrumMinFreq to spectrumMaxFreq.
+func renderSpectrumVisualizer(dl *imgui.DrawList, apu *chibines.APU, sampleRate float64) {
+	scope := apu.Scope()
+	if scope == nil {
+		return
+	}
+
+	imgui.Text(fmt.Sprintf("Spectrum (%d-%dHz)", int(spectrumMinFreq), int(spectrumMaxFreq)))
+	scope.ReadMix(spectrumSamples)
+	updateSpectrumLevels(spectrumSamples, sampleRate)
+
+	pos := imgui.CursorPos()
+	width := imgui.WindowContentRegionWidth()
+	const height = 260
+	dl.AddRectFilled(pos, imgui.Vec2{X: pos.X + width, Y: pos.Y + height}, scopeBackgroundColor)
+
+	barWidth := width / spectrumBands
+	for i, level := range spectrumLevels {
+		h := float32((level - spectrumMinDB) / -spectrumMinDB * height)
+		x := pos.X + float32(i)*barWidth
+		dl.AddRectFilled(imgui.Vec2{X: x + 1, Y: pos.Y + height - h}, imgui.Vec2{X: x + barWidth - 1, Y: pos.Y + height}, waveformColor)
+	}
+
+	// frequency labels
+	for _, f := range []float64{100, 1000, 10000} {
+		x := pos.X + float32(math.Log(f/spectrumMinFreq)/math.Log(spectrumMaxFreq/spectrumMinFreq))*width
+		label := fmt.Sprintf("%gkHz", f/1000)
+		if f < 1000 {
+			label = fmt.Sprintf("%gHz", f)
+		}
+		dl.AddText(imgui.Vec2{X: x, Y: pos.Y + 2}, scopeTextColor, label)
+	}
+	imgui.SetCursorPos(imgui.Vec2{X: pos.X, Y: pos.Y + height + 4})
+}
+
+// updateSpectrumLevels computes the level (dB) of each band, with the peak
+// falling slowly like a spectrum analyzer.
+func updateSpectrumLevels(samples []float32, sampleRate float64) {
+	now := glfw.GetTime()
+	fall := (now - spectrumTime) * spectrumFall
+	spectrumTime = now
+
+	n := len(samples)
+	x := spectrumBins
+	windowSum := 0.0
+	for i, v := range samples {
+		// Hann window
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		windowSum += w
+		x[i] = complex(float64(v)*w, 0)
+	}
+	fft(x)
+
+	ratio := math.Log(spectrumMaxFreq / spectrumMinFreq)
+	for band := range spectrumLevels {
+		low := spectrumMinFreq * math.Exp(ratio*float64(band)/spectrumBands)
+		high := spectrumMinFreq * math.Exp(ratio*float64(band+1)/spectrumBands)
+		first := int(low * float64(n) / sampleRate)
+		last := int(high * float64(n) / sampleRate)
+		if last >= n/2 {
+			last = n/2 - 1
+		}
+
+		peak := 0.0
+		for bin := first; bin <= last; bin++ {
+			peak = math.Max(peak, cmplx.Abs(x[bin]))
+		}
+		level := spectrumMinDB
+		if peak > 0 {
+			level = math.Max(20*math.Log10(peak*2/windowSum), spectrumMinDB)
+		}
+		spectrumLevels[band] = math.Max(level, spectrumLevels[band]-fall)
+	}
+}
+
+// fft is an in-place radix-2 FFT (len(x) must be a power of 2).
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
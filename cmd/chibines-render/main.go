@@ -0,0 +1,303 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kaishuu0123/chibines/chibines"
+	"github.com/kaishuu0123/chibines/chibines/input"
+	"github.com/kaishuu0123/chibines/chibines/midi"
+	"github.com/kaishuu0123/chibines/chibines/vgm"
+)
+
+var outputDir = flag.String("o", ".", "output directory")
+var seconds = flag.Float64("seconds", 120, "length to render (emulated seconds). Without it, NSF songs are rendered until they end (at most this long, then faded out)")
+var song = flag.Int("song", 0, "NSF song to render, from 1 (default: the starting song of the NSF)")
+var sampleRate = flag.Int("rate", 48000, "sample rate")
+var audioQualityName = flag.String("audio-quality", chibines.AudioQualityHigh.String(), "audio quality: low (fast, aliasing), medium, high (band-limited synthesis)")
+var audioPanning = flag.String("panning", "mono", "stereo panning preset of the master mix: "+strings.Join(chibines.PanningPresets(), ", ")+" (mono = mono output)")
+var audioMixMode = flag.String("mix", chibines.MixNonlinear.String(), "channel mixing: nonlinear (like the NES), linear (the stems add up to the master mix)")
+var stems = flag.Bool("stems", true, "write one WAV file per channel beside the master mix")
+var macroFile = flag.String("macros", "", "input macro file (.json) of the ROM run")
+var macroName = flag.String("macro", "", "macro played from the first frame of the ROM run")
+var macroPlayer = flag.Int("player", 1, "player (1-4) of the macro")
+var midiFile = flag.String("midi", "", "also transcribe the square, triangle and noise channels to this Standard MIDI File (.mid)")
+var vgmFile = flag.String("vgm", "", "also log the APU register writes to this file (.vgm, or .vgz gzip-compressed)")
+var patchFile = flag.String("patch", "", "patch file (.ips, .ups, .bps) applied to the ROM (default: game.ips/.ups/.bps beside the ROM)")
+
+// song end detection of NSF songs without -seconds (the defaults of
+// chibines-nsf)
+const (
+	nsfSongLoops   = 2
+	nsfSongFade    = 8 * time.Second
+	nsfSongSilence = 3 * time.Second
+)
+
+// wavOutput writes samples to a WAV file, buffered between two flushes.
+type wavOutput struct {
+	writer  *chibines.WAVWriter
+	path    string
+	samples []float32
+	err     error
+}
+
+func newWAVOutput(path string, channels int) *wavOutput {
+	writer, err := chibines.NewWAVWriter(path, *sampleRate, channels)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return &wavOutput{writer: writer, path: path}
+}
+
+func (o *wavOutput) flush() {
+	if o.err == nil {
+		o.err = o.writer.WriteSamples(o.samples)
+	}
+	o.samples = o.samples[:0]
+}
+
+func (o *wavOutput) close() {
+	o.flush()
+	if err := o.writer.Close(); err != nil && o.err == nil {
+		o.err = err
+	}
+	if o.err != nil {
+		log.Fatalln(o.err)
+	}
+	log.Printf("Render: saved. Path: %s\n", o.path)
+}
+
+// stemName returns the file name suffix of a channel ("Square 1" -> "square1").
+func stemName(channel chibines.APUChannel) string {
+	return strings.ToLower(strings.ReplaceAll(channel.String(), " ", ""))
+}
+
+func setupAudio(console *chibines.Console, prefix string) []*wavOutput {
+	quality, err := chibines.ParseAudioQuality(*audioQualityName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	mixMode, err := chibines.ParseAPUMixMode(*audioMixMode)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := console.APU.SetPanningPreset(*audioPanning); err != nil {
+		log.Fatalln(err)
+	}
+
+	console.SetAudioSampleRate(float64(*sampleRate))
+	console.SetAudioQuality(quality)
+	console.SetAudioStereo(*audioPanning != "mono")
+	console.APU.SetMixMode(mixMode)
+
+	master := newWAVOutput(filepath.Join(*outputDir, prefix+".wav"), console.AudioChannels())
+	console.SetAudioRecorder(func(sample float32) {
+		master.samples = append(master.samples, sample)
+	})
+	outputs := []*wavOutput{master}
+
+	if *stems {
+		var channels [chibines.APUChannelCount]*wavOutput
+		for i := range channels {
+			name := fmt.Sprintf("%s-%s.wav", prefix, stemName(chibines.APUChannel(i)))
+			channels[i] = newWAVOutput(filepath.Join(*outputDir, name), 1)
+			outputs = append(outputs, channels[i])
+		}
+		console.SetStemRecorder(func(samples []float32) {
+			for i, sample := range samples {
+				channels[i].samples = append(channels[i].samples, sample)
+			}
+		})
+	}
+	return outputs
+}
+
+// startVGMLog logs the register writes of console to the -vgm file (nil
+// without -vgm).
+func startVGMLog(console *chibines.Console, tags vgm.Tags) *vgm.Writer {
+	if *vgmFile == "" {
+		return nil
+	}
+	w, err := vgm.NewWriter(*vgmFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w.SetTags(tags)
+	console.SetAPURegisterLogger(w)
+	return w
+}
+
+func stopVGMLog(console *chibines.Console, w *vgm.Writer) {
+	if w == nil {
+		return
+	}
+	console.SetAPURegisterLogger(nil)
+	if err := w.Close(); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Render: saved. Path: %s\n", w.Path())
+}
+
+// newTranscriber returns the MIDI transcriber of -midi (nil without -midi).
+func newTranscriber(title string) *midi.Transcriber {
+	if *midiFile == "" {
+		return nil
+	}
+	t := midi.NewTranscriber()
+	t.SetTitle(title)
+	return t
+}
+
+func saveMIDI(t *midi.Transcriber) {
+	if t == nil {
+		return
+	}
+	if err := t.Save(*midiFile); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Render: saved. Path: %s\n", *midiFile)
+}
+
+// nsfString returns a string field of the NSF header (NUL-padded).
+func nsfString(field [32]byte) string {
+	return strings.TrimRight(string(field[:]), "\x00")
+}
+
+func flushOutputs(outputs []*wavOutput) {
+	for _, o := range outputs {
+		o.flush()
+	}
+}
+
+func renderNSF(path string, prefix string) []*wavOutput {
+	player, err := chibines.NewNSFPlayer(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *song > 0 {
+		if *song > int(player.NSFFileInfo.TotalSongs) {
+			log.Fatalf("no song %d (%d songs)\n", *song, player.NSFFileInfo.TotalSongs)
+		}
+		player.SetSong(byte(*song - 1))
+	}
+	prefix = fmt.Sprintf("%s-song%02d", prefix, player.CurrentSong+1)
+
+	outputs := setupAudio(player.Console, prefix)
+	info := player.NSFFileInfo
+	vgmWriter := startVGMLog(player.Console, vgm.Tags{
+		Track:  fmt.Sprintf("Song %d", player.CurrentSong+1),
+		Game:   nsfString(info.SongName),
+		Author: nsfString(info.ArtistName),
+		Notes:  nsfString(info.CopyrightHolder),
+	})
+	transcriber := newTranscriber(nsfString(info.SongName))
+
+	// without -seconds, render until the song ends
+	untilEnd := !isFlagSet("seconds")
+	if untilEnd {
+		player.DefaultSongLen = time.Duration(*seconds * float64(time.Second))
+		player.DefaultSongFadeLen = nsfSongFade
+		player.LoopCount = nsfSongLoops
+		player.SilenceLen = nsfSongSilence
+	}
+	// restart the song so that the log has its init writes (and with the
+	// song length)
+	player.SetSong(player.CurrentSong)
+
+	// step frame by frame (29780.5 CPU cycles)
+	const cyclesPerFrame = chibines.CPUFrequency / chibines.FrameRate
+	frames := int(*seconds * chibines.FrameRate)
+	for i := 0; ; i++ {
+		if untilEnd && player.Ended() || !untilEnd && i >= frames {
+			break
+		}
+		player.StepCycles(int(float64(i+1)*cyclesPerFrame) - int(float64(i)*cyclesPerFrame))
+		flushOutputs(outputs)
+		if transcriber != nil {
+			transcriber.Sample(player.Console.APU)
+		}
+	}
+	stopVGMLog(player.Console, vgmWriter)
+	saveMIDI(transcriber)
+	return outputs
+}
+
+func renderROM(path string, prefix string) []*wavOutput {
+	console, err := chibines.NewConsoleWithPatch(path, *patchFile, false)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	layer := input.NewLayer()
+	if *macroFile != "" {
+		if err := layer.LoadMacros(*macroFile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *macroName != "" {
+		if err := layer.PlayMacro(*macroName, *macroPlayer-1); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	outputs := setupAudio(console, prefix)
+	vgmWriter := startVGMLog(console, vgm.Tags{Game: prefix})
+	transcriber := newTranscriber(prefix)
+	frames := int(*seconds * chibines.FrameRate)
+	for i := 0; i < frames; i++ {
+		layer.ApplyTo(console, [input.MaxPlayers]input.State{})
+		console.StepFrame()
+		flushOutputs(outputs)
+		if transcriber != nil {
+			transcriber.Sample(console.APU)
+		}
+	}
+	stopVGMLog(console, vgmWriter)
+	saveMIDI(transcriber)
+	return outputs
+}
+
+// isFlagSet reports whether a flag is given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] file.nsf|file.nsfe|file.nes\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	path := flag.Arg(0)
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalln(err)
+	}
+	name := filepath.Base(path)
+	prefix := strings.TrimSuffix(name, filepath.Ext(name))
+
+	var outputs []*wavOutput
+	if ext := filepath.Ext(path); strings.EqualFold(ext, ".nsf") || strings.EqualFold(ext, ".nsfe") {
+		outputs = renderNSF(path, prefix)
+	} else {
+		outputs = renderROM(path, prefix)
+	}
+	for _, o := range outputs {
+		o.close()
+	}
+}
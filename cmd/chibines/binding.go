@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines/input"
+)
+
+const axisThreshold = 0.5
+
+type bindingKind int
+
+const (
+	bindingKey bindingKind = iota
+	bindingPadButton
+	bindingPadAxis
+	bindingJoystickButton
+	bindingJoystickAxis
+	bindingJoystickHat
+)
+
+type binding struct {
+	kind      bindingKind
+	key       glfw.Key
+	index     int
+	direction float32 // axis: -1 or +1
+	hat       glfw.JoystickHatState
+}
+
+// playerBindings is a compiled PlayerConfig, indexed like bindingButtonNames.
+type playerBindings struct {
+	joystick int
+	buttons  [][]binding
+}
+
+var keyNames = map[string]glfw.Key{
+	"Space": glfw.KeySpace, "Apostrophe": glfw.KeyApostrophe, "Comma": glfw.KeyComma,
+	"Minus": glfw.KeyMinus, "Period": glfw.KeyPeriod, "Slash": glfw.KeySlash,
+	"Semicolon": glfw.KeySemicolon, "Equal": glfw.KeyEqual, "LeftBracket": glfw.KeyLeftBracket,
+	"Backslash": glfw.KeyBackslash, "RightBracket": glfw.KeyRightBracket, "GraveAccent": glfw.KeyGraveAccent,
+	"Escape": glfw.KeyEscape, "Enter": glfw.KeyEnter, "Tab": glfw.KeyTab, "Backspace": glfw.KeyBackspace,
+	"Insert": glfw.KeyInsert, "Delete": glfw.KeyDelete, "Right": glfw.KeyRight, "Left": glfw.KeyLeft,
+	"Down": glfw.KeyDown, "Up": glfw.KeyUp, "PageUp": glfw.KeyPageUp, "PageDown": glfw.KeyPageDown,
+	"Home": glfw.KeyHome, "End": glfw.KeyEnd, "KPDecimal": glfw.KeyKPDecimal, "KPDivide": glfw.KeyKPDivide,
+	"KPMultiply": glfw.KeyKPMultiply, "KPSubtract": glfw.KeyKPSubtract, "KPAdd": glfw.KeyKPAdd,
+	"KPEnter": glfw.KeyKPEnter, "KPEqual": glfw.KeyKPEqual, "LeftShift": glfw.KeyLeftShift,
+	"LeftControl": glfw.KeyLeftControl, "LeftAlt": glfw.KeyLeftAlt, "RightShift": glfw.KeyRightShift,
+	"RightControl": glfw.KeyRightControl, "RightAlt": glfw.KeyRightAlt,
+}
+
+var gamepadButtonNames = map[string]glfw.GamepadButton{
+	"A": glfw.ButtonA, "B": glfw.ButtonB, "X": glfw.ButtonX, "Y": glfw.ButtonY,
+	"LeftBumper": glfw.ButtonLeftBumper, "RightBumper": glfw.ButtonRightBumper,
+	"Back": glfw.ButtonBack, "Start": glfw.ButtonStart, "Guide": glfw.ButtonGuide,
+	"LeftThumb": glfw.ButtonLeftThumb, "RightThumb": glfw.ButtonRightThumb,
+	"DpadUp": glfw.ButtonDpadUp, "DpadRight": glfw.ButtonDpadRight,
+	"DpadDown": glfw.ButtonDpadDown, "DpadLeft": glfw.ButtonDpadLeft,
+}
+
+var gamepadAxisNames = map[string]glfw.GamepadAxis{
+	"LeftX": glfw.AxisLeftX, "LeftY": glfw.AxisLeftY, "RightX": glfw.AxisRightX, "RightY": glfw.AxisRightY,
+	"LeftTrigger": glfw.AxisLeftTrigger, "RightTrigger": glfw.AxisRightTrigger,
+}
+
+var hatNames = map[string]glfw.JoystickHatState{
+	"up": glfw.HatUp, "right": glfw.HatRight, "down": glfw.HatDown, "left": glfw.HatLeft,
+}
+
+func init() {
+	for c := 'A'; c <= 'Z'; c++ {
+		keyNames[string(c)] = glfw.KeyA + glfw.Key(c-'A')
+	}
+	for i := 0; i <= 9; i++ {
+		keyNames[strconv.Itoa(i)] = glfw.Key0 + glfw.Key(i)
+		keyNames[fmt.Sprintf("KP%d", i)] = glfw.KeyKP0 + glfw.Key(i)
+	}
+	for i := 1; i <= 25; i++ {
+		keyNames[fmt.Sprintf("F%d", i)] = glfw.KeyF1 + glfw.Key(i-1)
+	}
+}
+
+func parseAxisDirection(s string) (string, float32, error) {
+	switch {
+	case strings.HasSuffix(s, "+"):
+		return strings.TrimSuffix(s, "+"), 1, nil
+	case strings.HasSuffix(s, "-"):
+		return strings.TrimSuffix(s, "-"), -1, nil
+	}
+	return "", 0, fmt.Errorf("axis direction (+ or -) required: %s", s)
+}
+
+func parseBinding(s string) (binding, error) {
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return binding{}, fmt.Errorf("invalid input: %s", s)
+	}
+
+	switch kind {
+	case "key":
+		key, ok := keyNames[value]
+		if !ok {
+			return binding{}, fmt.Errorf("unknown key: %s", value)
+		}
+		return binding{kind: bindingKey, key: key}, nil
+	case "pad":
+		if button, ok := gamepadButtonNames[value]; ok {
+			return binding{kind: bindingPadButton, index: int(button)}, nil
+		}
+		name, direction, err := parseAxisDirection(value)
+		if err != nil {
+			return binding{}, err
+		}
+		axis, ok := gamepadAxisNames[name]
+		if !ok {
+			return binding{}, fmt.Errorf("unknown gamepad input: %s", value)
+		}
+		return binding{kind: bindingPadAxis, index: int(axis), direction: direction}, nil
+	case "button":
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			return binding{}, fmt.Errorf("invalid joystick button: %s", value)
+		}
+		return binding{kind: bindingJoystickButton, index: index}, nil
+	case "axis":
+		name, direction, err := parseAxisDirection(value)
+		if err != nil {
+			return binding{}, err
+		}
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			return binding{}, fmt.Errorf("invalid joystick axis: %s", value)
+		}
+		return binding{kind: bindingJoystickAxis, index: index, direction: direction}, nil
+	case "hat":
+		name, direction, _ := strings.Cut(value, ":")
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			return binding{}, fmt.Errorf("invalid joystick hat: %s", value)
+		}
+		hat, ok := hatNames[direction]
+		if !ok {
+			return binding{}, fmt.Errorf("invalid joystick hat direction: %s", value)
+		}
+		return binding{kind: bindingJoystickHat, index: index, hat: hat}, nil
+	}
+	return binding{}, fmt.Errorf("invalid input: %s", s)
+}
+
+// compileBindings parses the config. Invalid inputs are logged and ignored.
+func compileBindings(config *Config) [input.MaxPlayers]playerBindings {
+	var result [input.MaxPlayers]playerBindings
+	for i, player := range config.Players {
+		result[i].joystick = player.Joystick
+		result[i].buttons = make([][]binding, len(bindingButtonNames))
+		for j, name := range bindingButtonNames {
+			for _, s := range player.Buttons[name] {
+				b, err := parseBinding(s)
+				if err != nil {
+					log.Printf("Player %d %s: %v\n", i+1, name, err)
+					continue
+				}
+				result[i].buttons[j] = append(result[i].buttons[j], b)
+			}
+		}
+	}
+	return result
+}
+
+// connected joysticks in joystick number order, updated by the joystick callback
+var joysticks []glfw.Joystick
+
+func initJoysticks(config *Config, configPath string) {
+	if path := config.gamepadMappingsPath(configPath); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Println(err)
+		} else if !glfw.UpdateGamepadMappings(string(data)) {
+			log.Printf("invalid gamepad mappings. Path: %s\n", path)
+		} else {
+			log.Printf("Gamepad mappings: loaded. Path: %s\n", path)
+		}
+	}
+
+	for joy := glfw.Joystick1; joy <= glfw.JoystickLast; joy++ {
+		if joy.Present() {
+			onJoystickConnected(joy)
+		}
+	}
+
+	glfw.SetJoystickCallback(func(joy glfw.Joystick, event glfw.PeripheralEvent) {
+		switch event {
+		case glfw.Connected:
+			onJoystickConnected(joy)
+		case glfw.Disconnected:
+			onJoystickDisconnected(joy)
+		}
+	})
+}
+
+func onJoystickConnected(joy glfw.Joystick) {
+	if joy.IsGamepad() {
+		log.Printf("Joystick%d connected: %s (gamepad: %s)\n", joy+1, joy.GetName(), joy.GetGamepadName())
+	} else {
+		log.Printf("Joystick%d connected: %s (no gamepad mapping, GUID: %s)\n", joy+1, joy.GetName(), joy.GetGUID())
+	}
+	joysticks = append(joysticks, joy)
+	sort.Slice(joysticks, func(i, j int) bool { return joysticks[i] < joysticks[j] })
+}
+
+func onJoystickDisconnected(joy glfw.Joystick) {
+	log.Printf("Joystick%d disconnected\n", joy+1)
+	for i, j := range joysticks {
+		if j == joy {
+			joysticks = append(joysticks[:i], joysticks[i+1:]...)
+			break
+		}
+	}
+}
+
+// playerJoystick returns the joystick assigned to player (0-3).
+func playerJoystick(player int, bindings *playerBindings) (glfw.Joystick, bool) {
+	if bindings.joystick > 0 {
+		joy := glfw.Joystick1 + glfw.Joystick(bindings.joystick-1)
+		return joy, joy <= glfw.JoystickLast && joy.Present()
+	}
+	if player < len(joysticks) {
+		return joysticks[player], true
+	}
+	return 0, false
+}
+
+type joystickState struct {
+	gamepad *glfw.GamepadState
+	buttons []glfw.Action
+	axes    []float32
+	hats    []glfw.JoystickHatState
+}
+
+func readJoystickState(joy glfw.Joystick) *joystickState {
+	if joy.IsGamepad() {
+		return &joystickState{gamepad: joy.GetGamepadState()}
+	}
+	return &joystickState{
+		buttons: joy.GetButtons(),
+		axes:    joy.GetAxes(),
+		hats:    joy.GetHats(),
+	}
+}
+
+func (b *binding) pressed(window *glfw.Window, joy *joystickState) bool {
+	if b.kind == bindingKey {
+		return window.GetKey(b.key) == glfw.Press
+	}
+	if joy == nil {
+		return false
+	}
+
+	// pad: inputs need a gamepad mapping, raw joystick inputs are used otherwise
+	switch b.kind {
+	case bindingPadButton:
+		return joy.gamepad != nil && joy.gamepad.Buttons[b.index] == glfw.Press
+	case bindingPadAxis:
+		return joy.gamepad != nil && joy.gamepad.Axes[b.index]*b.direction > axisThreshold
+	case bindingJoystickButton:
+		return b.index < len(joy.buttons) && joy.buttons[b.index] == glfw.Press
+	case bindingJoystickAxis:
+		return b.index < len(joy.axes) && joy.axes[b.index]*b.direction > axisThreshold
+	case bindingJoystickHat:
+		return b.index < len(joy.hats) && joy.hats[b.index]&b.hat != 0
+	}
+	return false
+}
+
+// processInputPlayer reads the keyboard and the joystick assigned to player (0-3).
+func processInputPlayer(window *glfw.Window, player int, bindings *playerBindings) input.State {
+	var joy *joystickState
+	if j, ok := playerJoystick(player, bindings); ok {
+		joy = readJoystickState(j)
+	}
+
+	var pressed [10]bool
+	for i, buttonBindings := range bindings.buttons {
+		for _, b := range buttonBindings {
+			if b.pressed(window, joy) {
+				pressed[i] = true
+				break
+			}
+		}
+	}
+
+	var state input.State
+	copy(state.Buttons[:], pressed[:8])
+	state.TurboA = pressed[8]
+	state.TurboB = pressed[9]
+	return state
+}
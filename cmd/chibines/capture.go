@@ -0,0 +1,101 @@
+package main
+
+import (
+	"image"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines/capture"
+)
+
+const (
+	screenshotKey = glfw.KeyF4
+	recordKey     = glfw.KeyF5
+)
+
+var recorder *capture.Recorder
+
+// capturePrefix returns the file name prefix of screenshots and recordings.
+func capturePrefix() string {
+	name := filepath.Base(romPath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func validRecordFormat(format string) bool {
+	for _, f := range capture.Formats() {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func saveScreenshot(frame *image.RGBA) {
+	path := capture.TimestampPath(*captureDir, capturePrefix(), "png")
+
+	// encode on another goroutine with a copy (frame is reused)
+	img := image.NewRGBA(frame.Rect)
+	copy(img.Pix, frame.Pix)
+	go func() {
+		if err := capture.SaveScreenshot(path, img); err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("Screenshot: saved. Path: %s\n", path)
+	}()
+}
+
+func startRecording(path string) {
+	r, err := capture.NewRecorder(path, audioForConsole.SampleRate, console.AudioChannels())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	console.SetAudioRecorder(r.WriteSample)
+	recorder = r
+	log.Printf("Recording: started. Path: %s\n", path)
+}
+
+func stopRecording() {
+	if recorder == nil {
+		return
+	}
+
+	console.SetAudioRecorder(nil)
+	if err := recorder.Close(); err != nil {
+		log.Println(err)
+	} else {
+		log.Printf("Recording: saved. Path: %s\n", recorder.Path())
+	}
+	if recorder.Dropped() > 0 {
+		log.Printf("Recording: %d frames dropped\n", recorder.Dropped())
+	}
+	recorder = nil
+}
+
+// processInputCapture handles the capture hotkeys and records frame, the
+// screen as rendered by the video renderer. The hotkeys are disabled while
+// the Family BASIC keyboard is connected (F4 / F5 are keys of it).
+func processInputCapture(window *glfw.Window, frame *image.RGBA) {
+	if familyBasicKeyboard == nil {
+		if isKeyTriggered(window, screenshotKey) {
+			saveScreenshot(frame)
+		}
+		if isKeyTriggered(window, recordKey) {
+			if recorder != nil {
+				stopRecording()
+			} else {
+				startRecording(capture.TimestampPath(*captureDir, capturePrefix(), *recordFormat))
+			}
+		}
+	}
+
+	if recorder != nil {
+		if err := recorder.WriteFrame(frame); err != nil {
+			log.Println(err)
+			stopRecording()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/kaishuu0123/chibines/chibines/input"
+)
+
+const (
+	configDirName       = "chibines"
+	configFileName      = "config.json"
+	gamepadMappingsFile = "gamecontrollerdb.txt"
+)
+
+// Button names used in the config file. TurboA / TurboB are handled by the
+// input layer.
+var bindingButtonNames = []string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right", "TurboA", "TurboB"}
+
+// PlayerConfig maps button names to inputs. An input is one of:
+//
+//	key:Z          keyboard key (see keyNames)
+//	pad:A          gamepad button (GLFW gamepad mapping, Xbox layout)
+//	pad:LeftX-     gamepad axis and direction
+//	button:0       raw joystick button (joysticks without a gamepad mapping)
+//	axis:1+        raw joystick axis and direction
+//	hat:0:up       raw joystick hat
+type PlayerConfig struct {
+	// Joystick is the joystick number (1-16). 0 assigns the N-th connected
+	// joystick to player N.
+	Joystick int                 `json:"joystick"`
+	Buttons  map[string][]string `json:"buttons"`
+}
+
+type Config struct {
+	// GamepadMappings is a file in SDL GameControllerDB format. If empty,
+	// gamecontrollerdb.txt in the config directory is used when it exists.
+	GamepadMappings string                         `json:"gamepadMappings,omitempty"`
+	Players         [input.MaxPlayers]PlayerConfig `json:"players"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, configDirName, configFileName)
+}
+
+func defaultConfig() *Config {
+	padButtons := map[string][]string{
+		"A":      {"pad:B", "button:0"},
+		"B":      {"pad:A", "button:1"},
+		"Select": {"pad:Back", "button:6"},
+		"Start":  {"pad:Start", "button:7"},
+		"Up":     {"pad:DpadUp", "pad:LeftY-", "axis:1-", "hat:0:up"},
+		"Down":   {"pad:DpadDown", "pad:LeftY+", "axis:1+", "hat:0:down"},
+		"Left":   {"pad:DpadLeft", "pad:LeftX-", "axis:0-", "hat:0:left"},
+		"Right":  {"pad:DpadRight", "pad:LeftX+", "axis:0+", "hat:0:right"},
+		"TurboA": {"pad:Y"},
+		"TurboB": {"pad:X"},
+	}
+	keys := [input.MaxPlayers]map[string]string{
+		{"A": "Z", "B": "X", "Select": "RightShift", "Start": "Enter", "Up": "Up", "Down": "Down", "Left": "Left", "Right": "Right", "TurboA": "Q", "TurboB": "W"},
+		{"A": "A", "B": "S", "Select": "LeftShift", "Start": "E", "Up": "I", "Down": "K", "Left": "J", "Right": "L", "TurboA": "Y", "TurboB": "U"},
+		{"A": "C", "B": "V", "Select": "1", "Start": "2", "Up": "T", "Down": "G", "Left": "F", "Right": "H"},
+		{"A": "KP1", "B": "KP2", "Select": "KP0", "Start": "KPEnter", "Up": "KP8", "Down": "KP5", "Left": "KP4", "Right": "KP6"},
+	}
+
+	config := &Config{}
+	for i := range config.Players {
+		player := &config.Players[i]
+		player.Buttons = map[string][]string{}
+		for _, name := range bindingButtonNames {
+			if key, ok := keys[i][name]; ok {
+				player.Buttons[name] = append(player.Buttons[name], "key:"+key)
+			}
+			player.Buttons[name] = append(player.Buttons[name], padButtons[name]...)
+		}
+	}
+	return config
+}
+
+// LoadConfig reads the config file. Buttons missing from the file keep
+// their default bindings.
+func LoadConfig(path string) (*Config, error) {
+	config := defaultConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fileConfig Config
+	if err := json.Unmarshal(data, &fileConfig); err != nil {
+		return nil, err
+	}
+
+	config.GamepadMappings = fileConfig.GamepadMappings
+	for i, player := range fileConfig.Players {
+		config.Players[i].Joystick = player.Joystick
+		for name, inputs := range player.Buttons {
+			config.Players[i].Buttons[name] = inputs
+		}
+	}
+	return config, nil
+}
+
+func (c *Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// gamepadMappingsPath returns the SDL GameControllerDB file to load, or ""
+func (c *Config) gamepadMappingsPath(configPath string) string {
+	if c.GamepadMappings != "" {
+		return c.GamepadMappings
+	}
+	if configPath == "" {
+		return ""
+	}
+	path := filepath.Join(filepath.Dir(configPath), gamepadMappingsFile)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
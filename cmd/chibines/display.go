@@ -0,0 +1,121 @@
+package main
+
+import (
+	"image"
+	"log"
+	"math"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines/video"
+)
+
+const (
+	scaleModeInteger = "integer"
+	scaleModeFit     = "fit"
+
+	aspectSquare = "square"
+	aspect8to7   = "8:7"
+
+	fullscreenKey = glfw.KeyF11
+)
+
+// display places the NES screen in the window.
+type display struct {
+	crop      video.Crop
+	aspect    float64 // pixel aspect ratio (width / height)
+	scaleMode string
+
+	rect image.Rectangle // where the screen is drawn, in window coordinates
+
+	fullscreen     bool
+	windowedX      int
+	windowedY      int
+	windowedWidth  int
+	windowedHeight int
+}
+
+func newDisplay(crop video.Crop, aspect string, scaleMode string) *display {
+	d := &display{
+		crop:      crop,
+		aspect:    1,
+		scaleMode: scaleMode,
+	}
+
+	switch aspect {
+	case aspectSquare:
+	case aspect8to7:
+		d.aspect = 8.0 / 7.0
+	default:
+		log.Fatalf("unknown aspect: %s\n", aspect)
+	}
+	switch scaleMode {
+	case scaleModeInteger, scaleModeFit:
+	default:
+		log.Fatalf("unknown scale mode: %s\n", scaleMode)
+	}
+
+	return d
+}
+
+// windowSize returns the window size for an integer scale.
+func (d *display) windowSize(scale int) (int, int) {
+	width := int(math.Round(float64(d.crop.Width()*scale) * d.aspect))
+	height := d.crop.Height() * scale
+	return width, height
+}
+
+// update computes the screen rectangle for the window size.
+func (d *display) update(windowWidth, windowHeight int) {
+	width := float64(d.crop.Width()) * d.aspect
+	height := float64(d.crop.Height())
+
+	scale := math.Min(float64(windowWidth)/width, float64(windowHeight)/height)
+	if d.scaleMode == scaleModeInteger && scale >= 1 {
+		scale = math.Floor(scale)
+	}
+
+	w := int(math.Round(width * scale))
+	h := int(math.Round(height * scale))
+	x := (windowWidth - w) / 2
+	y := (windowHeight - h) / 2
+	d.rect = image.Rect(x, y, x+w, y+h)
+}
+
+// screenPosition converts a window position to NES pixels. ok is false
+// outside of the screen.
+func (d *display) screenPosition(windowX, windowY float64) (x, y int, ok bool) {
+	if d.rect.Empty() {
+		return -1, -1, false
+	}
+
+	fx := (windowX - float64(d.rect.Min.X)) * float64(d.crop.Width()) / float64(d.rect.Dx())
+	fy := (windowY - float64(d.rect.Min.Y)) * float64(d.crop.Height()) / float64(d.rect.Dy())
+	x = d.crop.Left + int(math.Floor(fx))
+	y = d.crop.Top + int(math.Floor(fy))
+	ok = fx >= 0 && fx < float64(d.crop.Width()) && fy >= 0 && fy < float64(d.crop.Height())
+	return x, y, ok
+}
+
+func (d *display) toggleFullscreen(window *glfw.Window) {
+	if d.fullscreen {
+		window.SetMonitor(nil, d.windowedX, d.windowedY, d.windowedWidth, d.windowedHeight, 0)
+		d.fullscreen = false
+		return
+	}
+
+	monitor := glfw.GetPrimaryMonitor()
+	if monitor == nil {
+		return
+	}
+	d.windowedX, d.windowedY = window.GetPos()
+	d.windowedWidth, d.windowedHeight = window.GetSize()
+	mode := monitor.GetVideoMode()
+	window.SetMonitor(monitor, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+	d.fullscreen = true
+}
+
+func processInputDisplay(window *glfw.Window, d *display) {
+	if isKeyTriggered(window, fullscreenKey) {
+		d.toggleFullscreen(window)
+	}
+}
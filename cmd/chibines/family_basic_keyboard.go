@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+type familyBasicKeyBinding struct {
+	key   glfw.Key
+	fbKey chibines.FamilyBasicKey
+}
+
+// Host keyboard (US layout) -> Family BASIC keyboard
+var familyBasicKeyBindings = []familyBasicKeyBinding{
+	{glfw.KeyRightBracket, chibines.FamilyBasicKeyRightBracket},
+	{glfw.KeyLeftBracket, chibines.FamilyBasicKeyLeftBracket},
+	{glfw.KeyEnter, chibines.FamilyBasicKeyReturn},
+	{glfw.KeyKPEnter, chibines.FamilyBasicKeyReturn},
+	{glfw.KeyF8, chibines.FamilyBasicKeyF8},
+	{glfw.KeyEnd, chibines.FamilyBasicKeyStop},
+	{glfw.KeyBackslash, chibines.FamilyBasicKeyYen},
+	{glfw.KeyRightShift, chibines.FamilyBasicKeyRightShift},
+	{glfw.KeyRightAlt, chibines.FamilyBasicKeyKana},
+	{glfw.KeySemicolon, chibines.FamilyBasicKeySemicolon},
+	{glfw.KeyApostrophe, chibines.FamilyBasicKeyColon},
+	{glfw.KeyGraveAccent, chibines.FamilyBasicKeyAt},
+	{glfw.KeyF7, chibines.FamilyBasicKeyF7},
+	{glfw.KeyEqual, chibines.FamilyBasicKeyCaret},
+	{glfw.KeyMinus, chibines.FamilyBasicKeyMinus},
+	{glfw.KeySlash, chibines.FamilyBasicKeySlash},
+	{glfw.KeyPageDown, chibines.FamilyBasicKeyUnderscore},
+	{glfw.KeyK, chibines.FamilyBasicKeyK},
+	{glfw.KeyL, chibines.FamilyBasicKeyL},
+	{glfw.KeyO, chibines.FamilyBasicKeyO},
+	{glfw.KeyF6, chibines.FamilyBasicKeyF6},
+	{glfw.Key0, chibines.FamilyBasicKey0},
+	{glfw.KeyP, chibines.FamilyBasicKeyP},
+	{glfw.KeyComma, chibines.FamilyBasicKeyComma},
+	{glfw.KeyPeriod, chibines.FamilyBasicKeyPeriod},
+	{glfw.KeyJ, chibines.FamilyBasicKeyJ},
+	{glfw.KeyU, chibines.FamilyBasicKeyU},
+	{glfw.KeyI, chibines.FamilyBasicKeyI},
+	{glfw.KeyF5, chibines.FamilyBasicKeyF5},
+	{glfw.Key8, chibines.FamilyBasicKey8},
+	{glfw.Key9, chibines.FamilyBasicKey9},
+	{glfw.KeyN, chibines.FamilyBasicKeyN},
+	{glfw.KeyM, chibines.FamilyBasicKeyM},
+	{glfw.KeyH, chibines.FamilyBasicKeyH},
+	{glfw.KeyG, chibines.FamilyBasicKeyG},
+	{glfw.KeyY, chibines.FamilyBasicKeyY},
+	{glfw.KeyF4, chibines.FamilyBasicKeyF4},
+	{glfw.Key6, chibines.FamilyBasicKey6},
+	{glfw.Key7, chibines.FamilyBasicKey7},
+	{glfw.KeyV, chibines.FamilyBasicKeyV},
+	{glfw.KeyB, chibines.FamilyBasicKeyB},
+	{glfw.KeyD, chibines.FamilyBasicKeyD},
+	{glfw.KeyR, chibines.FamilyBasicKeyR},
+	{glfw.KeyT, chibines.FamilyBasicKeyT},
+	{glfw.KeyF3, chibines.FamilyBasicKeyF3},
+	{glfw.Key4, chibines.FamilyBasicKey4},
+	{glfw.Key5, chibines.FamilyBasicKey5},
+	{glfw.KeyC, chibines.FamilyBasicKeyC},
+	{glfw.KeyF, chibines.FamilyBasicKeyF},
+	{glfw.KeyA, chibines.FamilyBasicKeyA},
+	{glfw.KeyS, chibines.FamilyBasicKeyS},
+	{glfw.KeyW, chibines.FamilyBasicKeyW},
+	{glfw.KeyF2, chibines.FamilyBasicKeyF2},
+	{glfw.Key3, chibines.FamilyBasicKey3},
+	{glfw.KeyE, chibines.FamilyBasicKeyE},
+	{glfw.KeyZ, chibines.FamilyBasicKeyZ},
+	{glfw.KeyX, chibines.FamilyBasicKeyX},
+	{glfw.KeyLeftControl, chibines.FamilyBasicKeyControl},
+	{glfw.KeyQ, chibines.FamilyBasicKeyQ},
+	{glfw.KeyEscape, chibines.FamilyBasicKeyEscape},
+	{glfw.KeyF1, chibines.FamilyBasicKeyF1},
+	{glfw.Key2, chibines.FamilyBasicKey2},
+	{glfw.Key1, chibines.FamilyBasicKey1},
+	{glfw.KeyLeftAlt, chibines.FamilyBasicKeyGrph},
+	{glfw.KeyLeftShift, chibines.FamilyBasicKeyLeftShift},
+	{glfw.KeyLeft, chibines.FamilyBasicKeyLeft},
+	{glfw.KeyRight, chibines.FamilyBasicKeyRight},
+	{glfw.KeyUp, chibines.FamilyBasicKeyUp},
+	{glfw.KeyHome, chibines.FamilyBasicKeyClrHome},
+	{glfw.KeyInsert, chibines.FamilyBasicKeyIns},
+	{glfw.KeyDelete, chibines.FamilyBasicKeyDel},
+	{glfw.KeyBackspace, chibines.FamilyBasicKeyDel},
+	{glfw.KeySpace, chibines.FamilyBasicKeySpace},
+	{glfw.KeyDown, chibines.FamilyBasicKeyDown},
+}
+
+// Data recorder hotkeys
+const (
+	dataRecorderPlayKey   = glfw.KeyF9
+	dataRecorderRecordKey = glfw.KeyF10
+	dataRecorderStopKey   = glfw.KeyF12
+)
+
+func processInputFamilyBasicKeyboard(window *glfw.Window) [chibines.FamilyBasicKeyCount]bool {
+	var result [chibines.FamilyBasicKeyCount]bool
+	for _, binding := range familyBasicKeyBindings {
+		if window.GetKey(binding.key) == glfw.Press {
+			result[binding.fbKey] = true
+		}
+	}
+	return result
+}
+
+// processInputDataRecorder handles play (F9), record (F10) and stop (F12).
+// The tape is loaded from / saved to tapePath (.wav or raw bit file).
+func processInputDataRecorder(window *glfw.Window, recorder *chibines.DataRecorder, tapePath string) {
+	for _, key := range []glfw.Key{dataRecorderPlayKey, dataRecorderRecordKey, dataRecorderStopKey} {
+		if !isKeyTriggered(window, key) {
+			continue
+		}
+
+		switch key {
+		case dataRecorderPlayKey:
+			if tapePath != "" {
+				if err := recorder.Load(tapePath); err != nil {
+					log.Println(err)
+					continue
+				}
+			}
+			log.Println("Data Recorder: play")
+			recorder.Play()
+		case dataRecorderRecordKey:
+			log.Println("Data Recorder: record")
+			recorder.Record()
+		case dataRecorderStopKey:
+			wasRecording := recorder.IsRecording()
+			recorder.Stop()
+			log.Println("Data Recorder: stop")
+			if wasRecording && tapePath != "" {
+				if err := recorder.Save(tapePath); err != nil {
+					log.Println(err)
+					continue
+				}
+				log.Printf("Data Recorder: saved. Path: %s\n", tapePath)
+			}
+		}
+	}
+}
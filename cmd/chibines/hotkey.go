@@ -0,0 +1,14 @@
+package main
+
+import "github.com/go-gl/glfw/v3.3/glfw"
+
+var previousKeyState = map[glfw.Key]bool{}
+
+// isKeyTriggered reports whether key has just been pressed (edge detection
+// for hotkeys).
+func isKeyTriggered(window *glfw.Window, key glfw.Key) bool {
+	pressed := window.GetKey(key) == glfw.Press
+	triggered := pressed && !previousKeyState[key]
+	previousKeyState[key] = pressed
+	return triggered
+}
@@ -12,17 +12,14 @@ import (
 	"github.com/gordonklaus/portaudio"
 	"github.com/inkyblackness/imgui-go/v4"
 	"github.com/kaishuu0123/chibines/chibines"
+	"github.com/kaishuu0123/chibines/chibines/capture"
+	"github.com/kaishuu0123/chibines/chibines/input"
+	"github.com/kaishuu0123/chibines/chibines/video"
 	"github.com/kaishuu0123/chibines/internal/audio"
 	"github.com/kaishuu0123/chibines/internal/gui"
 	"golang.org/x/image/draw"
 )
 
-const (
-	SCALE         int = 2
-	WINDOW_WIDTH  int = 254 * SCALE
-	WINDOW_HEIGHT int = 240 * SCALE
-)
-
 var (
 	windowFlags imgui.WindowFlags = imgui.WindowFlagsNoCollapse |
 		imgui.WindowFlagsNoMove |
@@ -33,55 +30,190 @@ var (
 
 var console *chibines.Console
 var audioForConsole *audio.Audio
+var arkanoid *chibines.ArkanoidController
+var powerPad *chibines.PowerPad
+var familyBasicKeyboard *chibines.FamilyBasicKeyboard
+var inputLayer *input.Layer
+var palette *chibines.Palette
+var ntscFilter *chibines.NTSCFilter
+var videoRenderer *video.Renderer
+var screen *display
+var audioQuality chibines.AudioQuality
+var mixMode chibines.APUMixMode
+var romPath string
+var inputBindings [input.MaxPlayers]playerBindings
+
+var multitap = flag.String("multitap", "", "connect a 4-player adapter: fourscore (NES), famicom, hori")
+var zapperPort = flag.Int("zapper", 0, "connect a Zapper (aim with mouse, fire with left button) to port 1 or 2")
+var arkanoidPort = flag.Int("arkanoid", 0, "connect an Arkanoid controller (move with mouse, fire with left button) to port 1, 2 or 3 (Famicom expansion port)")
+var powerPadPort = flag.Int("powerpad", 0, "connect a Power Pad to port 1 or 2, or a Family Trainer Mat to port 3 (Famicom expansion port)")
+var familyBasicKeyboardEnabled = flag.Bool("keyboard", false, "connect a Family BASIC keyboard to the Famicom expansion port (the host keyboard is no longer used for controllers)")
+var tapeFile = flag.String("tape", "", "data recorder tape (.wav or raw bit file) for the Family BASIC keyboard (F9 = play, F10 = record, F12 = stop & save)")
+var turboOnFrames = flag.Int("turbo-on", input.DefaultTurboOnFrames, "frames turbo buttons are pressed")
+var turboOffFrames = flag.Int("turbo-off", input.DefaultTurboOffFrames, "frames turbo buttons are released")
+var macroFile = flag.String("macros", "", "input macro file (.json) loaded at startup and saved after recording")
+var configFile = flag.String("config", defaultConfigPath(), "key and gamepad binding config file (.json)")
+var writeConfig = flag.Bool("write-config", false, "write the current key and gamepad bindings to the config file and exit")
+var paletteFile = flag.String("palette", "", "palette: .pal file (64 or 512 colors) or \"ntsc\" to generate one")
+var paletteHue = flag.Float64("palette-hue", chibines.DefaultNTSCPaletteOptions().Hue, "hue (degrees) of the ntsc palette")
+var paletteSaturation = flag.Float64("palette-saturation", chibines.DefaultNTSCPaletteOptions().Saturation, "saturation of the ntsc palette")
+var paletteContrast = flag.Float64("palette-contrast", chibines.DefaultNTSCPaletteOptions().Contrast, "contrast of the ntsc palette")
+var paletteBrightness = flag.Float64("palette-brightness", chibines.DefaultNTSCPaletteOptions().Brightness, "brightness of the ntsc palette")
+var paletteGamma = flag.Float64("palette-gamma", chibines.DefaultNTSCPaletteOptions().Gamma, "display gamma of the ntsc palette")
+var ntscSharpness = flag.Float64("ntsc-sharpness", chibines.DefaultNTSCPaletteOptions().Sharpness, "sharpness of the ntsc filter (-1 to 1)")
+var ntscFringing = flag.Float64("ntsc-fringing", chibines.DefaultNTSCPaletteOptions().Fringing, "color fringing of the ntsc filter (-1 to 1)")
+var ntscFilterEnabled = flag.Bool("ntsc", false, "emulate the NTSC composite video signal (uses the -palette-* TV controls)")
+var videoFilter = flag.String("filter", "none", "video filter: "+strings.Join(video.Filters(), ", ")+" (F2 = next)")
+var videoOverlay = flag.String("overlay", "none", "video overlay: "+strings.Join(video.Overlays(), ", ")+" (F3 = next)")
+var windowScale = flag.Int("scale", 2, "initial window size (times the NES screen)")
+var scaleMode = flag.String("scale-mode", scaleModeInteger, "scaling of the screen to the window: integer, fit")
+var aspect = flag.String("aspect", aspect8to7, "pixel aspect ratio: 8:7 (like a TV), square")
+var fullscreen = flag.Bool("fullscreen", false, "start in fullscreen (F11 = toggle)")
+var overscanTop = flag.Int("overscan-top", 8, "pixels hidden at the top of the screen")
+var overscanBottom = flag.Int("overscan-bottom", 8, "pixels hidden at the bottom of the screen")
+var overscanLeft = flag.Int("overscan-left", 0, "pixels hidden at the left of the screen")
+var overscanRight = flag.Int("overscan-right", 0, "pixels hidden at the right of the screen")
+var captureDir = flag.String("capture-dir", "", "directory of screenshots (F4) and recordings (F5) (default: current directory)")
+var recordFormat = flag.String("record-format", capture.FormatAVI, "format of F5 recordings: y4m (+ .wav), avi, gif, apng")
+var recordFile = flag.String("record", "", "record to this file from the start (.y4m, .avi, .gif, .png)")
+var vgmFile = flag.String("vgm", "", "log the APU register writes of the ROM given on the command line to this file (.vgm, or .vgz gzip-compressed)")
+var syncMode = flag.String("sync", syncVsync, "emulation timing: vsync (one frame per refresh on 60Hz displays, smooth), time (elapsed time)")
+var audioQualityName = flag.String("audio-quality", chibines.AudioQualityMedium.String(), "audio quality: low (fast, aliasing), medium, high (band-limited synthesis)")
+var audioPanning = flag.String("panning", "mono", "stereo panning preset: "+strings.Join(chibines.PanningPresets(), ", ")+" (mono = mono output)")
+var audioMixMode = flag.String("mix", chibines.MixNonlinear.String(), "channel mixing: nonlinear (like the NES), linear")
+var audioRateControl = flag.Bool("audio-rate-control", true, "adjust the audio sample rate slightly to avoid underruns and overruns")
+var patchFile = flag.String("patch", "", "patch file (.ips, .ups, .bps) applied to the ROM (default: game.ips/.ups/.bps beside the ROM)")
 
 func StartAudio() {
 	// initialize audio
 	portaudio.Initialize()
 
-	audioForConsole = audio.NewAudio()
+	if console == nil {
+		log.Fatalln("console must be set")
+	}
+
+	// the output format is read by the audio callback: set it before the
+	// stream starts
+	console.SetAudioQuality(audioQuality)
+	console.APU.SetPanningPreset(*audioPanning)
+	console.SetAudioStereo(*audioPanning != "mono")
+	console.APU.SetMixMode(mixMode)
+
+	audioForConsole = audio.NewAudio(console)
 	if err := audioForConsole.Start(); err != nil {
 		log.Fatalln(err)
 	}
 
-	if console == nil {
-		log.Fatalln("console must be set")
+	console.SetAudioSampleRate(audioForConsole.SampleRate)
+	if *audioRateControl {
+		target := audioForConsole.SampleRate * audioTargetLatency * float64(console.AudioChannels())
+		console.SetAudioRateControl(int(target), audioMaxRateDelta)
 	}
+}
 
-	console.SetAudioChannel(audioForConsole.Channel)
-	console.SetAudioSampleRate(audioForConsole.SampleRate)
+func validPanningPreset(name string) bool {
+	for _, preset := range chibines.PanningPresets() {
+		if preset == name {
+			return true
+		}
+	}
+	return false
 }
 
 func StopAudio() {
 	if isRunning {
 		audioForConsole.Stop()
 		console.SetAudioSampleRate(0)
-		console.SetAudioChannel(nil)
+
+		buffer := console.AudioBuffer()
+		log.Printf("Audio: underruns = %d, overruns = %d\n", buffer.Underruns(), buffer.Overruns())
 
 		portaudio.Terminate()
 	}
 }
 
-func ResetConsole(file_name string) {
+func ResetConsole(file_name string, patch_file_name string) {
+	stopRecording()
+	stopVGMLog()
 	StopAudio()
 	isRunning = false
 
 	log.Println("Reset Console")
 	log.Printf("ROM file path: %s\n", file_name)
+	if patch_file_name != "" {
+		log.Printf("Patch file path: %s\n", patch_file_name)
+	}
 	var err error
-	console, err = chibines.NewConsole(file_name, false)
+	console, err = chibines.NewConsoleWithPatch(file_name, patch_file_name, false)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	console.SetPalette(palette)
+	romPath = file_name
+
+	switch *multitap {
+	case "fourscore":
+		console.ConnectFourScore()
+	case "famicom":
+		console.ConnectFamicomFourPlayerAdapter(false)
+	case "hori":
+		console.ConnectFamicomFourPlayerAdapter(true)
+	}
+
+	arkanoid = nil
+	if *arkanoidPort != 0 {
+		arkanoid = chibines.NewArkanoidController(*arkanoidPort == chibines.InputPortExpansion)
+		console.SetInputDevice(*arkanoidPort, arkanoid)
+	}
+	powerPad = nil
+	if *powerPadPort != 0 {
+		powerPad = chibines.NewPowerPad(*powerPadPort == chibines.InputPortExpansion)
+		console.SetInputDevice(*powerPadPort, powerPad)
+	}
+	familyBasicKeyboard = nil
+	if *familyBasicKeyboardEnabled {
+		familyBasicKeyboard = chibines.NewFamilyBasicKeyboard(console)
+		console.SetInputDevice(chibines.InputPortExpansion, familyBasicKeyboard)
+	}
+
 	isRunning = true
 
 	StartAudio()
 }
 
+func ntscPaletteOptions() chibines.NTSCPaletteOptions {
+	return chibines.NTSCPaletteOptions{
+		Hue:        *paletteHue,
+		Saturation: *paletteSaturation,
+		Contrast:   *paletteContrast,
+		Brightness: *paletteBrightness,
+		Gamma:      *paletteGamma,
+		Sharpness:  *ntscSharpness,
+		Fringing:   *ntscFringing,
+	}
+}
+
+func loadPalette(path string) *chibines.Palette {
+	switch path {
+	case "":
+		return nil
+	case "ntsc":
+		return chibines.GenerateNTSCPalette(ntscPaletteOptions())
+	}
+
+	p, err := chibines.LoadPalette(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Palette: loaded. Path: %s\n", path)
+	return p
+}
+
 func onDrop(names []string) {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("%s", names[0]))
 	dropInFiles := sb.String()
-	ResetConsole(dropInFiles)
+	ResetConsole(dropInFiles, "")
 }
 
 func renderGUI(w *gui.MasterWindow, texture *imgui.TextureID) {
@@ -92,14 +224,15 @@ func renderGUI(w *gui.MasterWindow, texture *imgui.TextureID) {
 		imgui.BackgroundDrawList().
 			AddImage(
 				*texture,
-				imgui.Vec2{X: 0, Y: 0},
-				imgui.Vec2{X: float32(WINDOW_WIDTH), Y: float32(WINDOW_HEIGHT)},
+				imgui.Vec2{X: float32(screen.rect.Min.X), Y: float32(screen.rect.Min.Y)},
+				imgui.Vec2{X: float32(screen.rect.Max.X), Y: float32(screen.rect.Max.Y)},
 			)
 	} else {
 		var msg string = "ChibiNES is currently stopped.\n\nPlease drag and drop ROM file."
 		textSize := imgui.CalcTextSize(msg, false, 0)
-		xpos := (float32(WINDOW_WIDTH) - textSize.X) / 2
-		ypos := (float32(WINDOW_HEIGHT) - textSize.Y) / 2
+		displaySize := w.Platform.DisplaySize()
+		xpos := (displaySize[0] - textSize.X) / 2
+		ypos := (displaySize[1] - textSize.Y) / 2
 		imgui.ForegroundDrawList().
 			AddText(
 				imgui.Vec2{X: xpos, Y: ypos},
@@ -117,48 +250,140 @@ func renderGUI(w *gui.MasterWindow, texture *imgui.TextureID) {
 
 func main() {
 	flag.Parse()
+	config, err := LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *writeConfig {
+		if err := config.Save(*configFile); err != nil {
+			log.Fatalln(err)
+		}
+		log.Printf("Config: saved. Path: %s\n", *configFile)
+		return
+	}
+	inputBindings = compileBindings(config)
+	palette = loadPalette(*paletteFile)
+	if *ntscFilterEnabled {
+		ntscFilter = chibines.NewNTSCFilter(ntscPaletteOptions())
+	}
+	videoRenderer = video.NewRenderer()
+	if err := videoRenderer.SetFilter(*videoFilter); err != nil {
+		log.Fatalln(err)
+	}
+	if err := videoRenderer.SetOverlay(*videoOverlay); err != nil {
+		log.Fatalln(err)
+	}
+	crop := video.Crop{Top: *overscanTop, Bottom: *overscanBottom, Left: *overscanLeft, Right: *overscanRight}
+	videoRenderer.SetCrop(crop)
+	screen = newDisplay(videoRenderer.Crop(), *aspect, *scaleMode)
+	audioQuality, err = chibines.ParseAudioQuality(*audioQualityName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if !validPanningPreset(*audioPanning) {
+		log.Fatalf("unknown panning preset: %s\n", *audioPanning)
+	}
+	mixMode, err = chibines.ParseAPUMixMode(*audioMixMode)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *syncMode != syncVsync && *syncMode != syncTime {
+		log.Fatalf("unknown sync mode: %s\n", *syncMode)
+	}
+	if !validRecordFormat(*recordFormat) {
+		log.Fatalf("unknown recording format: %s\n", *recordFormat)
+	}
+	inputLayer = newInputLayer(*macroFile)
 	if len(flag.Args()) >= 1 {
 		_, err := os.Stat(flag.Arg(0))
 		if err != nil {
 			log.Fatalln("no rom file specified or found")
 		}
 
-		ResetConsole(flag.Arg(0))
+		ResetConsole(flag.Arg(0), *patchFile)
+		if *recordFile != "" {
+			startRecording(*recordFile)
+		}
+		if *vgmFile != "" {
+			startVGMLog(*vgmFile)
+		}
 	}
 	defer StopAudio()
+	defer stopRecording()
+	defer stopVGMLog()
 
-	window := gui.NewMasterWindow("ChibiNES", WINDOW_WIDTH, WINDOW_HEIGHT, 0)
+	windowWidth, windowHeight := screen.windowSize(*windowScale)
+	window := gui.NewMasterWindow("ChibiNES", windowWidth, windowHeight, 0)
 	window.SetDropCallback(onDrop)
-	screenImage := image.NewRGBA(image.Rect(0, 0, WINDOW_WIDTH*SCALE, WINDOW_HEIGHT*SCALE))
-
-	if glfw.Joystick1.Present() {
-		joyname := glfw.Joystick1.GetName()
-		log.Printf("Joystick1 name: %s\n", joyname)
+	if *fullscreen {
+		screen.toggleFullscreen(window.Platform.Window)
 	}
+	screenImage := image.NewRGBA(image.Rect(0, 0, windowWidth, windowHeight))
+
+	initJoysticks(config, *configFile)
 
 	var buffer *image.RGBA
 	var texture imgui.TextureID
+	timer := newFrameTimer(*syncMode)
 	prev_timestamp := glfw.GetTime()
 	for !window.Platform.ShouldStop() {
 		cur_timestamp := glfw.GetTime()
 		window.Platform.ProcessEvents()
+		processInputDisplay(window.Platform.Window, screen)
 
-		if isRunning {
-			result1 := processInputController1(window.Platform.Window)
-			j1 := readJoyStick(glfw.Joystick1)
-			console.SetButtons1(combineButtons(result1, j1))
+		displaySize := window.Platform.DisplaySize()
+		screen.update(int(displaySize[0]), int(displaySize[1]))
 
-			result2 := processInputController2(window.Platform.Window)
-			console.SetButtons2(result2)
+		var states [input.MaxPlayers]input.State
+		if isRunning {
+			if familyBasicKeyboard != nil {
+				familyBasicKeyboard.SetKeys(processInputFamilyBasicKeyboard(window.Platform.Window))
+				processInputDataRecorder(window.Platform.Window, familyBasicKeyboard.DataRecorder, *tapeFile)
+			} else {
+				players := 2
+				if *multitap != "" {
+					players = input.MaxPlayers
+				}
+				for i := 0; i < players; i++ {
+					states[i] = processInputPlayer(window.Platform.Window, i, &inputBindings[i])
+				}
+				processInputMacros(window.Platform.Window, inputLayer, *macroFile)
+			}
+
+			if *zapperPort != 0 {
+				x, y, trigger := processInputZapper(window.Platform.Window)
+				console.SetZapper(*zapperPort, x, y, trigger)
+			}
+			if arkanoid != nil {
+				arkanoid.SetState(processInputArkanoid(window.Platform.Window))
+			}
+			if powerPad != nil {
+				powerPad.SetButtons(processInputPowerPad(window.Platform.Window))
+			}
 		}
 
 		dt := cur_timestamp - prev_timestamp
 		prev_timestamp = cur_timestamp
 
 		if isRunning {
-			console.StepSeconds(dt)
-
-			buffer = console.Buffer()
+			timer.step(console, dt, func() {
+				inputLayer.ApplyTo(console, states)
+			})
+
+			if ntscFilter != nil {
+				buffer = ntscFilter.Filter(console.OutputBuffer())
+			} else {
+				buffer = console.Buffer()
+			}
+			if familyBasicKeyboard == nil {
+				// F2 / F3 are keys of the Family BASIC keyboard
+				processInputVideo(window.Platform.Window, videoRenderer)
+			}
+			buffer = videoRenderer.Render(buffer)
+			processInputCapture(window.Platform.Window, buffer)
+			if screenImage.Rect.Size() != screen.rect.Size() && !screen.rect.Empty() {
+				screenImage = image.NewRGBA(image.Rectangle{Max: screen.rect.Size()})
+			}
 			draw.NearestNeighbor.Scale(screenImage, screenImage.Bounds(), buffer, buffer.Bounds(), draw.Over, nil)
 		}
 
@@ -168,68 +393,34 @@ func main() {
 	}
 }
 
-func processInputController1(window *glfw.Window) [8]bool {
-	var result [8]bool
-	result[chibines.ButtonA] = window.GetKey(glfw.KeyZ) == glfw.Press
-	result[chibines.ButtonB] = window.GetKey(glfw.KeyX) == glfw.Press
-	result[chibines.ButtonSelect] = window.GetKey(glfw.KeyRightShift) == glfw.Press
-	result[chibines.ButtonStart] = window.GetKey(glfw.KeyEnter) == glfw.Press
-	result[chibines.ButtonUp] = window.GetKey(glfw.KeyUp) == glfw.Press
-	result[chibines.ButtonDown] = window.GetKey(glfw.KeyDown) == glfw.Press
-	result[chibines.ButtonLeft] = window.GetKey(glfw.KeyLeft) == glfw.Press
-	result[chibines.ButtonRight] = window.GetKey(glfw.KeyRight) == glfw.Press
-	return result
+func processInputZapper(window *glfw.Window) (int, int, bool) {
+	x, y, ok := screen.screenPosition(window.GetCursorPos())
+	if !ok {
+		// outside of the screen: aim off-screen
+		x, y = -1, -1
+	}
+	trigger := window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press
+	return x, y, trigger
 }
 
-func processInputController2(window *glfw.Window) [8]bool {
-	var result [8]bool
-	result[chibines.ButtonA] = window.GetKey(glfw.KeyA) == glfw.Press
-	result[chibines.ButtonB] = window.GetKey(glfw.KeyS) == glfw.Press
-	result[chibines.ButtonSelect] = window.GetKey(glfw.KeyLeftShift) == glfw.Press
-	result[chibines.ButtonStart] = window.GetKey(glfw.KeyE) == glfw.Press
-	result[chibines.ButtonUp] = window.GetKey(glfw.KeyI) == glfw.Press
-	result[chibines.ButtonDown] = window.GetKey(glfw.KeyK) == glfw.Press
-	result[chibines.ButtonLeft] = window.GetKey(glfw.KeyJ) == glfw.Press
-	result[chibines.ButtonRight] = window.GetKey(glfw.KeyL) == glfw.Press
-	return result
+func processInputArkanoid(window *glfw.Window) (int, bool) {
+	// SetState clamps the position to the screen
+	x, _, _ := screen.screenPosition(window.GetCursorPos())
+	button := window.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press
+	return x, button
 }
 
-func readJoyStick(joy glfw.Joystick) [8]bool {
-	var result [8]bool
-	if !glfw.Joystick1.Present() {
-		return result
-	}
-	joyname := glfw.Joystick1.GetName()
-	axes := glfw.Joystick1.GetAxes()
-	buttons := glfw.Joystick1.GetButtons()
-	switch joyname {
-	case "DUALSHOCK 4 Wireless Controller":
-		result[chibines.ButtonA] = buttons[2] == 1
-		result[chibines.ButtonB] = buttons[1] == 1
-		result[chibines.ButtonSelect] = buttons[8] == 1
-		result[chibines.ButtonStart] = buttons[9] == 1
-		result[chibines.ButtonUp] = axes[1] < -0.5
-		result[chibines.ButtonDown] = axes[1] > 0.5
-		result[chibines.ButtonLeft] = axes[0] < -0.5
-		result[chibines.ButtonRight] = axes[0] > 0.5
-	default:
-		result[chibines.ButtonA] = buttons[0] == 1
-		result[chibines.ButtonB] = buttons[1] == 1
-		result[chibines.ButtonSelect] = buttons[6] == 1
-		result[chibines.ButtonStart] = buttons[7] == 1
-		result[chibines.ButtonUp] = axes[1] < -0.5
-		result[chibines.ButtonDown] = axes[1] > 0.5
-		result[chibines.ButtonLeft] = axes[0] < -0.5
-		result[chibines.ButtonRight] = axes[0] > 0.5
-	}
-
-	return result
+// Power Pad buttons 1-12 (4x3 grid)
+var powerPadKeys = [chibines.PowerPadButtons]glfw.Key{
+	glfw.KeyO, glfw.KeyP, glfw.KeyLeftBracket, glfw.KeyRightBracket,
+	glfw.KeyK, glfw.KeyL, glfw.KeySemicolon, glfw.KeyApostrophe,
+	glfw.KeyM, glfw.KeyComma, glfw.KeyPeriod, glfw.KeySlash,
 }
 
-func combineButtons(a, b [8]bool) [8]bool {
-	var result [8]bool
-	for i := 0; i < 8; i++ {
-		result[i] = a[i] || b[i]
+func processInputPowerPad(window *glfw.Window) [chibines.PowerPadButtons]bool {
+	var result [chibines.PowerPadButtons]bool
+	for i, key := range powerPadKeys {
+		result[i] = window.GetKey(key) == glfw.Press
 	}
 	return result
 }
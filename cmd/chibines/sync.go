@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+
+	"github.com/kaishuu0123/chibines/chibines"
+)
+
+const (
+	syncVsync = "vsync"
+	syncTime  = "time"
+
+	// dynamic rate control: samples kept in the audio buffer (seconds) and
+	// maximum sample rate adjustment
+	audioTargetLatency = 0.08
+	audioMaxRateDelta  = 0.005
+
+	// vsync: display refresh rates this close to the NES frame rate run one
+	// frame per refresh, the difference is absorbed by the rate control
+	vsyncTolerance = 0.005
+)
+
+// frameTimer advances the emulation once per iteration of the main loop.
+type frameTimer struct {
+	vsync     bool
+	averageDt float64
+	cycles    float64 // CPU cycles left to run (time mode)
+	frame     uint64  // last frame whose input was applied
+}
+
+func newFrameTimer(mode string) *frameTimer {
+	return &frameTimer{vsync: mode == syncVsync}
+}
+
+// step runs the emulation for a loop iteration which took dt seconds: one
+// frame when the loop runs at about the NES frame rate (vsync at 60Hz), dt
+// seconds otherwise (other refresh rates, or slow frames). applyInput is
+// called at the start of each emulated frame, so turbo and macros advance
+// with the emulated frames whatever the number of frames per iteration.
+func (t *frameTimer) step(console *chibines.Console, dt float64, applyInput func()) {
+	if t.averageDt == 0 {
+		t.averageDt = dt
+	} else {
+		t.averageDt += (dt - t.averageDt) * 0.05
+	}
+
+	if t.vsync && math.Abs(t.averageDt*chibines.FrameRate-1) < vsyncTolerance {
+		t.startFrame(console, applyInput)
+		console.StepFrame()
+		return
+	}
+
+	t.cycles += dt * chibines.CPUFrequency
+	for t.cycles > 0 {
+		t.startFrame(console, applyInput)
+		t.cycles -= float64(console.Step())
+	}
+}
+
+// startFrame calls applyInput once per frame, before its first cycle.
+func (t *frameTimer) startFrame(console *chibines.Console, applyInput func()) {
+	if frame := console.PPU.Frame; frame != t.frame {
+		t.frame = frame
+		applyInput()
+	}
+}
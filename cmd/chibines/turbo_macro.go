@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines/input"
+)
+
+// macro slots: F6 - F8 play a macro on player 1, Ctrl + F6 - F8 start / stop recording
+var macroSlots = []struct {
+	key  glfw.Key
+	name string
+}{
+	{glfw.KeyF6, "1"},
+	{glfw.KeyF7, "2"},
+	{glfw.KeyF8, "3"},
+}
+
+func newInputLayer(macroPath string) *input.Layer {
+	layer := input.NewLayer()
+	layer.SetTurboRate(*turboOnFrames, *turboOffFrames)
+
+	if macroPath != "" {
+		if _, err := os.Stat(macroPath); err == nil {
+			if err := layer.LoadMacros(macroPath); err != nil {
+				log.Println(err)
+			} else {
+				log.Printf("Macro: loaded. Path: %s\n", macroPath)
+			}
+		}
+	}
+
+	return layer
+}
+
+func processInputMacros(window *glfw.Window, layer *input.Layer, macroPath string) {
+	ctrl := window.GetKey(glfw.KeyLeftControl) == glfw.Press ||
+		window.GetKey(glfw.KeyRightControl) == glfw.Press
+
+	for _, slot := range macroSlots {
+		if !isKeyTriggered(window, slot.key) {
+			continue
+		}
+
+		if !ctrl {
+			if err := layer.PlayMacro(slot.name, 0); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+
+		if !layer.IsRecording() {
+			log.Printf("Macro: recording %s\n", slot.name)
+			layer.StartRecording(slot.name, 0)
+			continue
+		}
+
+		macro := layer.StopRecording()
+		if macro == nil {
+			continue
+		}
+		log.Printf("Macro: recorded %s (%d frames)\n", macro.Name, len(macro.Frames))
+		if macroPath != "" {
+			if err := layer.SaveMacros(macroPath); err != nil {
+				log.Println(err)
+				continue
+			}
+			log.Printf("Macro: saved. Path: %s\n", macroPath)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+
+	"github.com/kaishuu0123/chibines/chibines/vgm"
+)
+
+var vgmWriter *vgm.Writer
+
+// startVGMLog logs the APU register writes of the console to path (.vgm or
+// .vgz) until stopVGMLog.
+func startVGMLog(path string) {
+	w, err := vgm.NewWriter(path)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	w.SetTags(vgm.Tags{Game: capturePrefix()})
+	console.SetAPURegisterLogger(w)
+	vgmWriter = w
+	log.Printf("VGM: started. Path: %s\n", path)
+}
+
+func stopVGMLog() {
+	if vgmWriter == nil {
+		return
+	}
+
+	console.SetAPURegisterLogger(nil)
+	if err := vgmWriter.Close(); err != nil {
+		log.Println(err)
+	} else {
+		log.Printf("VGM: saved. Path: %s\n", vgmWriter.Path())
+	}
+	vgmWriter = nil
+}
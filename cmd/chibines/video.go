@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/kaishuu0123/chibines/chibines/video"
+)
+
+const (
+	nextVideoFilterKey  = glfw.KeyF2
+	nextVideoOverlayKey = glfw.KeyF3
+)
+
+func processInputVideo(window *glfw.Window, renderer *video.Renderer) {
+	if isKeyTriggered(window, nextVideoFilterKey) {
+		renderer.SetFilter(video.Next(video.Filters(), renderer.Filter()))
+		log.Printf("Video filter: %s\n", renderer.Filter())
+	}
+	if isKeyTriggered(window, nextVideoOverlayKey) {
+		renderer.SetOverlay(video.Next(video.Overlays(), renderer.Overlay()))
+		log.Printf("Video overlay: %s\n", renderer.Overlay())
+	}
+}
@@ -4,16 +4,25 @@ import "github.com/gordonklaus/portaudio"
 
 const GLOBAL_VOLUME = 0.5
 
+// SampleReader is the source of the samples (mono, or interleaved stereo),
+// e.g. chibines.Console.
+type SampleReader interface {
+	ReadSamples(out []float32) int
+	AudioChannels() int
+}
+
 type Audio struct {
 	stream         *portaudio.Stream
 	SampleRate     float64
 	outputChannels int
-	Channel        chan float32
+	source         SampleReader
+	samples        []float32
+	lastSample     [2]float32
 }
 
-func NewAudio() *Audio {
+func NewAudio(source SampleReader) *Audio {
 	a := Audio{}
-	a.Channel = make(chan float32, 44100)
+	a.source = source
 	return &a
 }
 
@@ -23,6 +32,9 @@ func (a *Audio) Start() error {
 		return err
 	}
 	parameters := portaudio.HighLatencyParameters(nil, host.DefaultOutputDevice)
+	// the parameters must be known before the first callback
+	a.SampleRate = parameters.SampleRate
+	a.outputChannels = parameters.Output.Channels
 	stream, err := portaudio.OpenStream(parameters, a.Callback)
 	if err != nil {
 		return err
@@ -31,8 +43,6 @@ func (a *Audio) Start() error {
 		return err
 	}
 	a.stream = stream
-	a.SampleRate = parameters.SampleRate
-	a.outputChannels = parameters.Output.Channels
 	return nil
 }
 
@@ -41,16 +51,40 @@ func (a *Audio) Stop() error {
 }
 
 func (a *Audio) Callback(out []float32) {
-	var output float32
-	for i := range out {
-		if i%a.outputChannels == 0 {
-			select {
-			case sample := <-a.Channel:
-				output = sample * GLOBAL_VOLUME
-			default:
-				output = 0
+	channels := a.source.AudioChannels()
+	frames := len(out) / a.outputChannels
+	if cap(a.samples) < frames*channels {
+		a.samples = make([]float32, frames*channels)
+	}
+	samples := a.samples[:frames*channels]
+	n := a.source.ReadSamples(samples) / channels
+	// underrun: hold the last sample (dropping to 0 clicks)
+	for i := n * channels; i < len(samples); i++ {
+		samples[i] = a.lastSample[i%channels]
+	}
+	if len(samples) > 0 {
+		copy(a.lastSample[:], samples[len(samples)-channels:])
+	}
+
+	for i := 0; i < frames; i++ {
+		frame := out[i*a.outputChannels : (i+1)*a.outputChannels]
+		if channels == 1 {
+			for j := range frame {
+				frame[j] = samples[i] * GLOBAL_VOLUME
 			}
+			continue
+		}
+
+		left, right := samples[i*2], samples[i*2+1]
+		if len(frame) == 1 {
+			frame[0] = (left + right) / 2 * GLOBAL_VOLUME
+			continue
+		}
+		frame[0] = left * GLOBAL_VOLUME
+		frame[1] = right * GLOBAL_VOLUME
+		// (surround outputs: both sides)
+		for j := 2; j < len(frame); j++ {
+			frame[j] = (left + right) / 2 * GLOBAL_VOLUME
 		}
-		out[i] = output
 	}
 }